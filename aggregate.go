@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	aggregatePathParameter    = "path"
+	aggregateFlagParameter    = "flag"
+	aggregateGroupByParameter = "groupBy"
+	aggregateBucketParameter  = "bucket"
+	rangeFromParameter        = "from"
+	rangeToParameter          = "to"
+	groupByFlagValue          = "flag"
+)
+
+type Aggregation struct {
+	Flag   *int       `json:"flag,omitempty"`
+	Bucket *time.Time `json:"bucket,omitempty"`
+	Count  int        `json:"count"`
+	Min    float64    `json:"min"`
+	Max    float64    `json:"max"`
+	Mean   float64    `json:"mean"`
+	P50    float64    `json:"p50"`
+	P90    float64    `json:"p90"`
+	P99    float64    `json:"p99"`
+}
+
+type aggregationQuery struct {
+	path        []string
+	flag        int
+	hasFlag     bool
+	groupByFlag bool
+	bucket      time.Duration
+	from        time.Time
+	to          time.Time
+}
+
+type aggregationKey struct {
+	flag   int
+	bucket time.Time
+}
+
+func aggregateHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	query, err := getAggregationQueryFromRequest(r)
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	aggregations := aggregateEvents(eventStore, query)
+
+	if len(aggregations) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		w.Header().Set("content-type", jsonContentType)
+		writeResponseBody(w, &aggregations)
+	}
+}
+
+func getAggregationQueryFromRequest(r *http.Request) (query aggregationQuery, err error) {
+	parameters := r.URL.Query()
+
+	path := parameters.Get(aggregatePathParameter)
+	if path == "" {
+		return query, errMissingParameter(aggregatePathParameter)
+	}
+	query.path = strings.Split(path, ".")
+
+	if flag := parameters.Get(aggregateFlagParameter); flag != "" {
+		if query.flag, err = parseFlag(flag); err != nil {
+			return
+		}
+		query.hasFlag = true
+	}
+
+	switch groupBy := parameters.Get(aggregateGroupByParameter); groupBy {
+	case "":
+	case groupByFlagValue:
+		query.groupByFlag = true
+	default:
+		return query, errInvalidParameter(aggregateGroupByParameter)
+	}
+
+	if bucket := parameters.Get(aggregateBucketParameter); bucket != "" {
+		if query.bucket, err = time.ParseDuration(bucket); err != nil {
+			return
+		}
+		if query.bucket <= 0 {
+			return query, errInvalidParameter(aggregateBucketParameter)
+		}
+	}
+
+	query.from, query.to, err = getTimeRangeFromRequest(r)
+	return
+}
+
+func getTimeRangeFromRequest(r *http.Request) (from, to time.Time, err error) {
+	parameters := r.URL.Query()
+
+	if value := parameters.Get(rangeFromParameter); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return
+		}
+	}
+
+	if value := parameters.Get(rangeToParameter); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// aggregateEvents streams the events of the time range, only keeping the values at the path
+func aggregateEvents(eventStore EventStore, query aggregationQuery) []Aggregation {
+	valuesByKey := map[aggregationKey][]float64{}
+
+	eventStore.StreamEventsBetween(query.from, query.to, func(event Event) bool {
+		if query.hasFlag && !contains(event.Flags, query.flag) {
+			return true
+		}
+
+		value, ok := extractNumberFromData(event.Data, query.path)
+		if !ok {
+			return true
+		}
+
+		for _, key := range getAggregationKeys(event, query) {
+			valuesByKey[key] = append(valuesByKey[key], value)
+		}
+
+		return true
+	})
+
+	aggregations := []Aggregation{}
+	for _, key := range sortedAggregationKeys(valuesByKey) {
+		aggregations = append(aggregations, computeAggregation(key, valuesByKey[key], query))
+	}
+
+	return aggregations
+}
+
+func getAggregationKeys(event Event, query aggregationQuery) (keys []aggregationKey) {
+	bucket := time.Time{}
+	if query.bucket > 0 {
+		bucket = event.Timestamp.UTC().Truncate(query.bucket)
+	}
+
+	if !query.groupByFlag {
+		return []aggregationKey{{bucket: bucket}}
+	}
+
+	if query.hasFlag {
+		return []aggregationKey{{flag: query.flag, bucket: bucket}}
+	}
+
+	for _, flag := range event.Flags {
+		keys = append(keys, aggregationKey{flag: flag, bucket: bucket})
+	}
+
+	return
+}
+
+func sortedAggregationKeys(valuesByKey map[aggregationKey][]float64) []aggregationKey {
+	keys := make([]aggregationKey, 0, len(valuesByKey))
+	for key := range valuesByKey {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].flag != keys[j].flag {
+			return keys[i].flag < keys[j].flag
+		}
+		return keys[i].bucket.Before(keys[j].bucket)
+	})
+
+	return keys
+}
+
+func computeAggregation(key aggregationKey, values []float64, query aggregationQuery) (aggregation Aggregation) {
+	sort.Float64s(values)
+
+	if query.groupByFlag {
+		flag := key.flag
+		aggregation.Flag = &flag
+	}
+	if query.bucket > 0 {
+		bucket := key.bucket
+		aggregation.Bucket = &bucket
+	}
+
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+
+	aggregation.Count = len(values)
+	aggregation.Min = values[0]
+	aggregation.Max = values[len(values)-1]
+	aggregation.Mean = sum / float64(len(values))
+	aggregation.P50 = percentile(values, 50)
+	aggregation.P90 = percentile(values, 90)
+	aggregation.P99 = percentile(values, 99)
+
+	return
+}
+
+// percentile uses the nearest-rank method on an already sorted slice
+func percentile(sortedValues []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sortedValues))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sortedValues[rank-1]
+}
+
+func extractNumberFromData(data string, path []string) (float64, bool) {
+	var content interface{}
+	if json.Unmarshal([]byte(data), &content) != nil {
+		return 0, false
+	}
+
+	for _, key := range path {
+		object, ok := content.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		if content, ok = object[key]; !ok {
+			return 0, false
+		}
+	}
+
+	value, ok := content.(float64)
+	return value, ok
+}
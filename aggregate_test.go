@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregateRequest(t *testing.T) {
+	store = &StubEventStore{events: timerEvents}
+
+	t.Run("Aggregate request should compute statistics over the given Data path", func(t *testing.T) {
+		request := newGetRequest(api_url + "aggregate?path=timer_niveau4")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := []Aggregation{{Count: 4, Min: 100, Max: 400, Mean: 250, P50: 200, P90: 400, P99: 400}}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+		assertAggregations(t, getAggregationsFromResponse(t, response), want)
+	})
+
+	t.Run("Aggregate request should follow nested Data paths", func(t *testing.T) {
+		request := newGetRequest(api_url + "aggregate?path=level.score")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := []Aggregation{{Count: 1, Min: 12, Max: 12, Mean: 12, P50: 12, P90: 12, P99: 12}}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertAggregations(t, getAggregationsFromResponse(t, response), want)
+	})
+
+	t.Run("Aggregate request should group by flag", func(t *testing.T) {
+		request := newGetRequest(api_url + "aggregate?path=timer_niveau4&groupBy=flag")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := []Aggregation{
+			{Flag: intPointer(1), Count: 3, Min: 100, Max: 400, Mean: 700.0 / 3, P50: 200, P90: 400, P99: 400},
+			{Flag: intPointer(2), Count: 2, Min: 300, Max: 400, Mean: 350, P50: 300, P90: 400, P99: 400},
+		}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertAggregations(t, getAggregationsFromResponse(t, response), want)
+	})
+
+	t.Run("Aggregate request should filter by flag and group by time bucket", func(t *testing.T) {
+		request := newGetRequest(api_url + "aggregate?path=timer_niveau4&flag=1&bucket=24h")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := []Aggregation{
+			{Bucket: timePointer(time.Date(2020, time.November, 13, 0, 0, 0, 0, time.UTC)), Count: 2, Min: 100, Max: 200, Mean: 150, P50: 100, P90: 200, P99: 200},
+			{Bucket: timePointer(time.Date(2020, time.November, 14, 0, 0, 0, 0, time.UTC)), Count: 1, Min: 400, Max: 400, Mean: 400, P50: 400, P90: 400, P99: 400},
+		}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertAggregations(t, getAggregationsFromResponse(t, response), want)
+	})
+
+	t.Run("Aggregate request should only consider events within the given time range", func(t *testing.T) {
+		request := newGetRequest(api_url + "aggregate?path=timer_niveau4&from=2020-11-14T00:00:00Z")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := []Aggregation{{Count: 2, Min: 300, Max: 400, Mean: 350, P50: 300, P90: 400, P99: 400}}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertAggregations(t, getAggregationsFromResponse(t, response), want)
+	})
+
+	t.Run("Aggregate request should return status code 404 when no numeric value is found", func(t *testing.T) {
+		request := newGetRequest(api_url + "aggregate?path=location")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("Aggregate request should return status code 422 when parameters are invalid", func(t *testing.T) {
+		for _, query := range []string{"", "?path=timer&flag=a", "?path=timer&groupBy=id", "?path=timer&bucket=day", "?path=timer&from=yesterday"} {
+			request := newGetRequest(api_url + "aggregate" + query)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	cases := map[float64]float64{0: 1, 50: 5, 90: 9, 99: 10, 100: 10}
+
+	for p, want := range cases {
+		if got := percentile(values, p); got != want {
+			t.Errorf("incorrect percentile %v: got %v, want %v", p, got, want)
+		}
+	}
+}
+
+// Data
+var timerEvents = []Event{
+	{Id: 1, Timestamp: time.Date(2020, time.November, 13, 20, 1, 49, 0, time.UTC), Flags: []int{1}, Data: `{"timer_niveau4": 100}`},
+	{Id: 2, Timestamp: time.Date(2020, time.November, 13, 21, 1, 49, 0, time.UTC), Flags: []int{1}, Data: `{"timer_niveau4": 200, "location": "FR"}`},
+	{Id: 3, Timestamp: time.Date(2020, time.November, 14, 8, 0, 0, 0, time.UTC), Flags: []int{2}, Data: `{"timer_niveau4": 300}`},
+	{Id: 4, Timestamp: time.Date(2020, time.November, 14, 9, 0, 0, 0, time.UTC), Flags: []int{1, 2}, Data: `{"timer_niveau4": 400}`},
+	{Id: 5, Timestamp: time.Date(2020, time.November, 14, 10, 0, 0, 0, time.UTC), Flags: []int{1}, Data: `{"timer_niveau4": "slow", "level": {"score": 12}}`},
+	createNeutralEventWithId(6),
+}
+
+// Helpers
+func assertAggregations(t *testing.T, got, want []Aggregation) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("aggregations are different:\ngot %+v\nwant %+v", got, want)
+	}
+}
+
+func getAggregationsFromResponse(t *testing.T, response *httptest.ResponseRecorder) (aggregations []Aggregation) {
+	t.Helper()
+
+	err := json.NewDecoder(response.Body).Decode(&aggregations)
+
+	if err != nil {
+		t.Fatalf("unable to parse response from server %q into aggregations: %v", response.Body, err)
+	}
+
+	return
+}
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func timePointer(value time.Time) *time.Time {
+	return &value
+}
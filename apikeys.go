@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apikeys_url = "/api/admin/apikeys/"
+
+	apiKeyPrefix       = "gek_"
+	apiKeyRandomLength = 32
+	apiKeyPrefixLength = len(apiKeyPrefix) + 8
+)
+
+// APIKey is stored with the SHA-256 hash of its key only, the key itself being
+// returned once by the creation request
+type APIKey struct {
+	Id        int        `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Roles     []string   `json:"roles"`
+	Tenant    string     `json:"tenant,omitempty"`
+	Key       string     `json:"key,omitempty"`
+	Hash      string     `json:"-"`
+	CreatedAt time.Time  `json:"createdat"`
+	RevokedAt *time.Time `json:"revokedat,omitempty"`
+}
+
+func getAllAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyList := []APIKey{}
+	for _, apiKey := range store.GetAllAPIKeys() {
+		if canManageTenant(r, apiKey.Tenant) {
+			apiKeyList = append(apiKeyList, apiKey)
+		}
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &apiKeyList)
+}
+
+func postAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey, err := getAPIKeyFromRequest(r)
+
+	if err != nil || apiKey.Name == "" || len(apiKey.Roles) == 0 || !isValidRoleList(apiKey.Roles) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !canManageTenant(r, apiKey.Tenant) {
+		apiKey.Tenant = getTenant(r)
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	apiKey = APIKey{Name: apiKey.Name, Roles: apiKey.Roles, Tenant: apiKey.Tenant, Prefix: key[:apiKeyPrefixLength], Hash: hashAPIKey(key), CreatedAt: clock.Now()}
+	parameters := map[string]string{"name": apiKey.Name, "roles": strings.Join(apiKey.Roles, ","), "tenant": apiKey.Tenant}
+	if _, err := auditAction(r, parameters, func() int {
+		apiKey.Id = store.RegisterAPIKey(apiKey)
+		parameters["id"] = strconv.Itoa(apiKey.Id)
+		return 1
+	}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	apiKey.Key = key
+
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &apiKey)
+}
+
+func deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := extractIntFromURL(r, "id")
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	affectedLines, err := auditAction(r, nil, func() (affectedLines int) {
+		for _, apiKey := range store.GetAllAPIKeys() {
+			if apiKey.Id == id && canManageTenant(r, apiKey.Tenant) {
+				affectedLines = store.RevokeAPIKey(id, clock.Now())
+			}
+		}
+
+		return
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = w.Write(formatLineNumberResponse(affectedLines))
+}
+
+// canManageTenant restricts admins to the keys and audit entries of their own tenant. Only the
+// bootstrap key, held by the operator, manages every tenant
+func canManageTenant(r *http.Request, tenant string) bool {
+	principal, ok := getPrincipal(r)
+	if !ok || principal.bootstrap {
+		return true
+	}
+
+	return principal.Tenant == tenant
+}
+
+func getAPIKeyFromRequest(r *http.Request) (apiKey APIKey, err error) {
+	dataSent, _ := ioutil.ReadAll(r.Body)
+	err = json.Unmarshal(dataSent, &apiKey)
+	return
+}
+
+func generateAPIKey() (string, error) {
+	randomBytes := make([]byte, apiKeyRandomLength)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	return apiKeyPrefix + hex.EncodeToString(randomBytes), nil
+}
+
+// hashAPIKey does not need a slow hash: keys are random and long enough to resist brute force
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
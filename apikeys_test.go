@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	clock = MockClock{}
+
+	t.Run("Requests should return status code 401 without a valid API key", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}}
+		useAuthentication(t, "bootstrap-key")
+
+		for _, key := range []string{"", "unknown-key"} {
+			request := newGetRequest(api_url + "1")
+			request.Header.Set(apiKeyHeader, key)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnauthorized)
+			assertHeader(t, response, "WWW-Authenticate", apiKeyAuthScheme)
+		}
+	})
+
+	t.Run("Created API key should authenticate requests and only be stored hashed", func(t *testing.T) {
+		stub := &StubEventStore{events: []Event{validEvent1}}
+		store = stub
+		useAuthentication(t, "bootstrap-key")
+
+		apiKey := createAPIKey(t, "bootstrap-key", "game-server", readerRole)
+
+		if !strings.HasPrefix(apiKey.Key, apiKeyPrefix) || apiKey.Prefix != apiKey.Key[:apiKeyPrefixLength] {
+			t.Errorf("incorrect key %q with prefix %q", apiKey.Key, apiKey.Prefix)
+		}
+		if stub.apiKeys[0].Key != "" || stub.apiKeys[0].Hash != hashAPIKey(apiKey.Key) {
+			t.Errorf("API key should only be stored hashed, got %+v", stub.apiKeys[0])
+		}
+
+		request := newGetRequest(api_url + "1")
+		request.Header.Set(apiKeyHeader, apiKey.Key)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		request = newGetRequest(api_url + "1")
+		request.Header.Set(authorizationHeader, "ApiKey "+apiKey.Key)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("Get request should list API keys without their key or hash", func(t *testing.T) {
+		store = &StubEventStore{apiKeys: []APIKey{{Id: 1, Name: "game-server", Prefix: "gek_01234567", Roles: []string{clientRole}, Hash: "abc"}}}
+		useAuthentication(t, "bootstrap-key")
+
+		request := newGetRequest(apikeys_url)
+		request.Header.Set(apiKeyHeader, "bootstrap-key")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "[{\"id\":1,\"name\":\"game-server\",\"prefix\":\"gek_01234567\",\"roles\":[\"client\"],\"createdat\":\"0001-01-01T00:00:00Z\"}]\n")
+	})
+
+	t.Run("Revoked API key should no longer authenticate requests", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}}
+		useAuthentication(t, "bootstrap-key")
+
+		apiKey := createAPIKey(t, "bootstrap-key", "game-server", readerRole)
+
+		request := newDeleteRequest(apikeys_url + "1")
+		request.Header.Set(apiKeyHeader, "bootstrap-key")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "{\"affectedlines\":1}")
+
+		request = newGetRequest(api_url + "1")
+		request.Header.Set(apiKeyHeader, apiKey.Key)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("Post request should return status code 422 when API key has no name or invalid roles", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		for _, apiKey := range []APIKey{{Roles: []string{readerRole}}, {Name: "game-server"}, {Name: "game-server", Roles: []string{"root"}}} {
+			request := newRequestWithBody(http.MethodPost, apikeys_url, apiKey)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("Authentication should expose the principal to handlers", func(t *testing.T) {
+		store = &StubEventStore{apiKeys: []APIKey{{Id: 3, Name: "anti-cheat", Roles: []string{staffRole}, Hash: hashAPIKey("gek_secret")}}}
+		useAuthentication(t, "")
+
+		var got Principal
+		handler := authenticationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = getPrincipal(r)
+		}))
+
+		request := newGetRequest(api_url)
+		request.Header.Set(apiKeyHeader, "gek_secret")
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		if !reflect.DeepEqual(got, Principal{Subject: "anti-cheat", APIKeyId: 3, Roles: []string{staffRole}}) {
+			t.Errorf("incorrect principal %+v", got)
+		}
+	})
+}
+
+func TestRequireAuthenticationSetting(t *testing.T) {
+	cases := map[string]bool{"": true, "true": true, "1": true, "false": false, "0": false}
+
+	for value, want := range cases {
+		got, err := parseRequireAuthentication(value)
+
+		assertNoError(t, err)
+		if got != want {
+			t.Errorf("REQUIRE_AUTHENTICATION=%q: got %v, want %v", value, got, want)
+		}
+	}
+
+	if _, err := parseRequireAuthentication("yes please"); err == nil {
+		t.Errorf("an invalid value should be refused")
+	}
+}
+
+// Helpers
+func useAuthentication(t *testing.T, bootstrapKey string) {
+	t.Helper()
+
+	previousRequired, previousKey := requireAuthentication, bootstrapAPIKey
+	requireAuthentication, bootstrapAPIKey = true, bootstrapKey
+	t.Cleanup(func() { requireAuthentication, bootstrapAPIKey = previousRequired, previousKey })
+}
+
+func createAPIKey(t *testing.T, adminKey, name string, roles ...string) (apiKey APIKey) {
+	t.Helper()
+
+	request := newRequestWithBody(http.MethodPost, apikeys_url, APIKey{Name: name, Roles: roles})
+	request.Header.Set(apiKeyHeader, adminKey)
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, request)
+
+	assertStatus(t, response.Code, http.StatusOK)
+	if err := json.NewDecoder(response.Body).Decode(&apiKey); err != nil {
+		t.Fatalf("unable to parse response from server %q into API key: %v", response.Body, err)
+	}
+
+	return
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	audit_url             = "/api/admin/audit/"
+	auditSubjectParameter = "subject"
+)
+
+var errAuditNotRecorded = errors.New("audit entry not recorded")
+
+// AuditEntry records a destructive or administrative request in the transaction of its action. The
+// audit table is append-only: stores offer no way to update or delete its entries
+type AuditEntry struct {
+	Id            int               `json:"id"`
+	Time          time.Time         `json:"time"`
+	Subject       string            `json:"subject"`
+	APIKeyId      int               `json:"apikeyid,omitempty"`
+	Tenant        string            `json:"tenant,omitempty"`
+	Method        string            `json:"method"`
+	Route         string            `json:"route"`
+	Parameters    map[string]string `json:"parameters,omitempty"`
+	AffectedLines int               `json:"affectedlines"`
+}
+
+func getAuditEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := getTimeRangeFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	subject := r.URL.Query().Get(auditSubjectParameter)
+
+	entryList := []AuditEntry{}
+	for _, entry := range store.GetAuditEntries(from, to) {
+		if (subject == "" || entry.Subject == subject) && canManageTenant(r, entry.Tenant) {
+			entryList = append(entryList, entry)
+		}
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &entryList)
+}
+
+// auditAction applies action and records the request in the audit table within the same store
+// transaction, with its route variables and the parameters read from its body, read once action
+// ran so that it can add the ids it assigns. Secrets must never be given as parameters. Handlers
+// answer 500 when the entry cannot be recorded: the action is then rolled back
+func auditAction(r *http.Request, parameters map[string]string, action func() int) (int, error) {
+	principal, _ := getPrincipal(r)
+
+	entry := AuditEntry{
+		Time:       clock.Now(),
+		Subject:    principal.Subject,
+		APIKeyId:   principal.APIKeyId,
+		Tenant:     principal.Tenant,
+		Method:     r.Method,
+		Route:      getRouteTemplate(r),
+		Parameters: map[string]string{},
+	}
+
+	for key, value := range mux.Vars(r) {
+		entry.Parameters[key] = value
+	}
+
+	affectedLines, ok := store.RegisterAuditedAction(entry, func() int {
+		affectedLines := action()
+		for key, value := range parameters {
+			entry.Parameters[key] = value
+		}
+
+		return affectedLines
+	})
+	if !ok {
+		return 0, errAuditNotRecorded
+	}
+
+	return affectedLines, nil
+}
+
+func getRouteTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+
+	return r.URL.Path
+}
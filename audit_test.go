@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	clock = MockClock{}
+
+	t.Run("Delete requests should be recorded with their principal, route, parameters and affected count", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}, events: []Event{validEvent1, validEvent2, validEvent5}, apiKeys: roleAPIKeys()}
+		store = stub
+		useAuthentication(t, "")
+
+		serveWithAPIKey(newDeleteRequest(api_url+"1"), "staff-key")
+		serveWithAPIKey(newDeleteRequest(api_url+"deleteflag/2"), "staff-key")
+
+		assertAuditEntries(t, stub.audit, []AuditEntry{
+			{Id: 1, Time: clock.Now(), Subject: staffRole, APIKeyId: 3, Method: http.MethodDelete, Route: api_route + "{id}", Parameters: map[string]string{"controller": defaultController, "id": "1"}, AffectedLines: 1},
+			{Id: 2, Time: clock.Now(), Subject: staffRole, APIKeyId: 3, Method: http.MethodDelete, Route: api_route + "deleteflag/{flag}", Parameters: map[string]string{"controller": defaultController, "flag": "2"}, AffectedLines: 2},
+		})
+	})
+
+	t.Run("Admin actions should be recorded without secrets", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}, flags: []Flag{{Id: 2, Name: "kill"}}, apiKeys: roleAPIKeys()}
+		store = stub
+		useAuthentication(t, "bootstrap-key")
+
+		serveWithAPIKey(newRequestWithBody(http.MethodPut, flags_url+"2", Flag{Name: "frag"}), "bootstrap-key")
+		serveWithAPIKey(newRequestWithBody(http.MethodPost, webhooks_url, Webhook{Collection: defaultController, Url: "https://example.com/hook", Secret: "webhook-secret"}), "admin-key")
+
+		assertAuditEntries(t, stub.audit, []AuditEntry{
+			{Id: 1, Time: clock.Now(), Subject: bootstrapPrincipal, Method: http.MethodPut, Route: flags_url + "{id}", Parameters: map[string]string{"id": "2", "name": "frag"}, AffectedLines: 1},
+			{Id: 2, Time: clock.Now(), Subject: adminRole, APIKeyId: 4, Method: http.MethodPost, Route: webhooks_url, Parameters: map[string]string{"id": "1", "collection": defaultController, "url": "https://example.com/hook"}, AffectedLines: 1},
+		})
+	})
+
+	t.Run("Rejected requests should not be recorded", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}, events: []Event{validEvent1}, apiKeys: roleAPIKeys()}
+		store = stub
+		useAuthentication(t, "")
+
+		serveWithAPIKey(newDeleteRequest(api_url+"1"), "reader-key")
+		serveWithAPIKey(newDeleteRequest(api_url+"abc"), "staff-key")
+
+		assertAuditEntries(t, stub.audit, nil)
+	})
+
+	t.Run("Requests should return status code 500 without applying their action when their entry cannot be recorded", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}, events: []Event{validEvent1}, flags: []Flag{{Id: 2, Name: "kill"}}}
+		store = auditFailingEventStore{stub}
+
+		requests := []*http.Request{
+			newDeleteRequest(api_url + "1"),
+			newRequestWithBody(http.MethodPut, flags_url+"2", Flag{Name: "frag"}),
+			newRequestWithBody(http.MethodPost, webhooks_url, Webhook{Collection: defaultController, Url: "https://example.com/hook", Secret: "webhook-secret"}),
+		}
+
+		for _, request := range requests {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusInternalServerError)
+		}
+
+		if !reflect.DeepEqual(stub.events[0], validEvent1) || stub.flags[0].Name != "kill" || len(stub.webhooks) != 0 {
+			t.Errorf("actions should not be applied, got events %+v, flags %+v and webhooks %+v", stub.events, stub.flags, stub.webhooks)
+		}
+	})
+
+	t.Run("Get request should return the entries of the time range and subject", func(t *testing.T) {
+		stub := &StubEventStore{apiKeys: roleAPIKeys(), audit: []AuditEntry{
+			{Id: 1, Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Subject: staffRole, Method: http.MethodDelete},
+			{Id: 2, Time: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), Subject: adminRole, Method: http.MethodDelete},
+			{Id: 3, Time: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), Subject: staffRole, Method: http.MethodDelete},
+		}}
+		store = stub
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newGetRequest(audit_url+"?from=2020-01-02T00:00:00Z&subject=staff"), "admin-key")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertAuditEntries(t, getAuditEntriesFromResponse(t, response.Body), []AuditEntry{stub.audit[2]})
+
+		response = serveWithAPIKey(newGetRequest(audit_url+"?subject=reader"), "admin-key")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "[]\n")
+	})
+
+	t.Run("Get request should return status code 422 with an invalid time range", func(t *testing.T) {
+		store = &StubEventStore{apiKeys: roleAPIKeys()}
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newGetRequest(audit_url+"?from=yesterday"), "admin-key")
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("Only admins should read the audit log", func(t *testing.T) {
+		store = &StubEventStore{apiKeys: roleAPIKeys()}
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newGetRequest(audit_url), "staff-key")
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+}
+
+// Test doubles
+// auditFailingEventStore cannot record audit entries, so that their actions are rolled back
+type auditFailingEventStore struct {
+	*StubEventStore
+}
+
+func (s auditFailingEventStore) RegisterAuditedAction(entry AuditEntry, action func() int) (int, bool) {
+	return 0, false
+}
+
+// Helpers
+func assertAuditEntries(t *testing.T, got, want []AuditEntry) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d audit entries %+v, want %d", len(got), got, len(want))
+	}
+
+	for i := range got {
+		if !got[i].Time.Equal(want[i].Time) {
+			t.Errorf("incorrect time for entry %d, got %v, want %v", i, got[i].Time, want[i].Time)
+		}
+		got[i].Time = want[i].Time
+
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("incorrect audit entry, got %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func getAuditEntriesFromResponse(t *testing.T, body io.Reader) (entryList []AuditEntry) {
+	t.Helper()
+
+	if err := json.NewDecoder(body).Decode(&entryList); err != nil {
+		t.Fatalf("unable to parse response from server %q into audit entries: %v", body, err)
+	}
+
+	return
+}
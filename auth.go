@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiKeyHeader        = "X-API-Key"
+	apiKeyAuthScheme    = "ApiKey"
+	bootstrapPrincipal  = "bootstrap"
+	authorizationHeader = "Authorization"
+)
+
+var (
+	requireAuthentication bool
+	bootstrapAPIKey       string
+)
+
+// Principal is the authenticated caller of a request, Claims being set for bearer tokens only
+// and bootstrap for the bootstrap key only
+type Principal struct {
+	Subject   string                 `json:"subject"`
+	APIKeyId  int                    `json:"apikeyid,omitempty"`
+	Roles     []string               `json:"roles"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+	bootstrap bool
+}
+
+type principalContextKey struct{}
+
+func authenticationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireAuthentication {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, ok := authenticate(r)
+		if !ok {
+			w.Header().Add("WWW-Authenticate", apiKeyAuthScheme)
+			if jwtKeys != nil {
+				w.Header().Add("WWW-Authenticate", bearerAuthScheme)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal)))
+	})
+}
+
+// parseRequireAuthentication requires authentication unless it is explicitly disabled, as the
+// administration routes are open to every request without it
+func parseRequireAuthentication(value string) (bool, error) {
+	if value == "" {
+		return true, nil
+	}
+
+	return strconv.ParseBool(value)
+}
+
+func authenticate(r *http.Request) (Principal, bool) {
+	scheme, token, _ := strings.Cut(r.Header.Get(authorizationHeader), " ")
+	if strings.EqualFold(scheme, bearerAuthScheme) {
+		return authenticateBearerToken(strings.TrimSpace(token))
+	}
+
+	key := getAPIKeyFromHeaders(r)
+	if key == "" {
+		return authenticateClientCertificate(r)
+	}
+
+	if bootstrapAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(bootstrapAPIKey)) == 1 {
+		return Principal{Subject: bootstrapPrincipal, Roles: []string{adminRole}, bootstrap: true}, true
+	}
+
+	apiKey := store.GetAPIKeyByHash(hashAPIKey(key))
+	if apiKey.Id == 0 || apiKey.RevokedAt != nil {
+		return Principal{}, false
+	}
+
+	return Principal{Subject: apiKey.Name, APIKeyId: apiKey.Id, Roles: apiKey.Roles, Tenant: apiKey.Tenant}, true
+}
+
+func getAPIKeyFromHeaders(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+
+	scheme, key, found := strings.Cut(r.Header.Get(authorizationHeader), " ")
+	if found && strings.EqualFold(scheme, apiKeyAuthScheme) {
+		return strings.TrimSpace(key)
+	}
+
+	return ""
+}
+
+func getPrincipal(r *http.Request) (principal Principal, ok bool) {
+	principal, ok = r.Context().Value(principalContextKey{}).(Principal)
+	return
+}
+
+// getTenant gives the default tenant, empty, to unauthenticated requests
+func getTenant(r *http.Request) string {
+	principal, _ := getPrincipal(r)
+	return principal.Tenant
+}
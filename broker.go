@@ -0,0 +1,91 @@
+package main
+
+import "sync"
+
+const subscriptionBufferSize = 256
+
+type subscription struct {
+	collection  string
+	tenant      string
+	flags       []int
+	hiddenFlags []int
+	events      chan Event
+}
+
+// eventBroker is the in-process pub/sub fed with events once they are registered.
+// A subscriber too slow to drain its buffer is dropped, its channel being closed.
+type eventBroker struct {
+	sync.Mutex
+	subscriptions map[*subscription]struct{}
+}
+
+var broker = newEventBroker()
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscriptions: map[*subscription]struct{}{}}
+}
+
+func (b *eventBroker) subscribe(collection, tenant string, flags, hiddenFlags []int) *subscription {
+	b.Lock()
+	defer b.Unlock()
+
+	s := &subscription{collection: collection, tenant: tenant, flags: flags, hiddenFlags: hiddenFlags, events: make(chan Event, subscriptionBufferSize)}
+	b.subscriptions[s] = struct{}{}
+
+	return s
+}
+
+func (b *eventBroker) unsubscribe(s *subscription) {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.subscriptions[s]; ok {
+		delete(b.subscriptions, s)
+		close(s.events)
+	}
+}
+
+func (b *eventBroker) publish(collection string, eventList []Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	for s := range b.subscriptions {
+		if s.collection != collection {
+			continue
+		}
+
+		for _, event := range eventList {
+			if !s.matches(event) {
+				continue
+			}
+
+			select {
+			case s.events <- event:
+			default:
+				delete(b.subscriptions, s)
+				close(s.events)
+			}
+
+			if _, ok := b.subscriptions[s]; !ok {
+				break
+			}
+		}
+	}
+}
+
+func (s *subscription) matches(event Event) bool {
+	if event.Tenant != s.tenant || isHiddenEvent(event, s.hiddenFlags) {
+		return false
+	}
+
+	if len(s.flags) == 0 {
+		return true
+	}
+
+	for _, flag := range s.flags {
+		if contains(event.Flags, flag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	changesSinceParameter = "since"
+	changesLimitParameter = "limit"
+	lastSequenceHeader    = "X-Last-Sequence"
+	changeCreated         = "created"
+	changeDeleted         = "deleted"
+)
+
+var maxChangesLimit = 1000
+
+// Change is an entry of the change log, written by the store in the same transaction as
+// the insert or neutralization it records, a deleted change carrying the neutralized event.
+// Sequence numbers are shared by every collection and taken when the transaction writes, not
+// when it commits: a later sequence may be visible before an earlier one. Stores therefore only
+// return the changes committed below the oldest sequence still in progress, so that a client
+// resuming after the last sequence it received never skips a change
+type Change struct {
+	Sequence int64  `json:"sequence"`
+	Type     string `json:"type"`
+	Event    Event  `json:"event"`
+}
+
+// changesHandler returns a page of at most limit changes, and in lastSequenceHeader the sequence
+// to resume from, which may follow the last change returned when the page ends with hidden ones
+func changesHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	since, err := getSinceFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	limit, err := getChangesLimitFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	changeList, lastSequence := eventStore.GetChangesSince(since, limit)
+	if changeList == nil {
+		changeList = []Change{}
+	}
+
+	w.Header().Set(lastSequenceHeader, strconv.FormatInt(lastSequence, 10))
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &changeList)
+}
+
+// getChangesLimitFromRequest defaults to maxChangesLimit and lowers larger limits to it
+func getChangesLimitFromRequest(r *http.Request) (int, error) {
+	value := r.URL.Query().Get(changesLimitParameter)
+	if value == "" {
+		return maxChangesLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, errInvalidParameter(changesLimitParameter)
+	}
+	if limit > maxChangesLimit {
+		limit = maxChangesLimit
+	}
+
+	return limit, nil
+}
+
+func getSinceFromRequest(r *http.Request) (since int64, err error) {
+	value := r.URL.Query().Get(changesSinceParameter)
+	if value == "" {
+		return
+	}
+
+	if since, err = strconv.ParseInt(value, 10, 64); err == nil && since < 0 {
+		err = errInvalidParameter(changesSinceParameter)
+	}
+
+	return
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestChangesRequest(t *testing.T) {
+	t.Run("Changes request should list insertions and neutralizations in sequence order", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostRequestTo(api_url, withoutIds(validEvent1, validEvent2)))
+		storedEvents := append([]Event{}, stub.events...)
+		server.ServeHTTP(httptest.NewRecorder(), newDeleteRequest(api_url+"1"))
+
+		request := newGetRequest(api_url + "changes")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		neutralizedEvent := createNeutralEventWithId(1)
+		neutralizedEvent.Hash = storedEvents[0].Hash
+
+		want := []Change{
+			{Sequence: 1, Type: changeCreated, Event: storedEvents[0]},
+			{Sequence: 2, Type: changeCreated, Event: storedEvents[1]},
+			{Sequence: 3, Type: changeDeleted, Event: neutralizedEvent},
+		}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+		assertChanges(t, getChangesFromResponse(t, response), want)
+	})
+
+	t.Run("Changes request should only return changes after the given sequence", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}, events: []Event{validEvent1, validEvent2}}
+		server.ServeHTTP(httptest.NewRecorder(), newDeleteRequest(api_url+"deleteflag/5"))
+		server.ServeHTTP(httptest.NewRecorder(), newDeleteRequest(api_url+"1"))
+
+		request := newGetRequest(api_url + "changes?since=1")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := []Change{{Sequence: 2, Type: changeDeleted, Event: createNeutralEventWithId(1)}}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertChanges(t, getChangesFromResponse(t, response), want)
+	})
+
+	t.Run("Changes request should return an empty list when nothing changed", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		request := newGetRequest(api_url + "changes?since=12")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "[]\n")
+	})
+
+	t.Run("Changes request should return status code 422 when since is invalid", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		for _, since := range []string{"a", "-1"} {
+			request := newGetRequest(api_url + "changes?since=" + since)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("Changes request should return pages of at most limit changes and the sequence to resume from", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}, events: []Event{validEvent1, validEvent2, validEvent4}}
+		for _, id := range []string{"1", "2", "4"} {
+			server.ServeHTTP(httptest.NewRecorder(), newDeleteRequest(api_url+id))
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest(api_url+"changes?limit=2"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Header().Get(lastSequenceHeader), "2")
+		if changes := getChangesFromResponse(t, response); len(changes) != 2 || changes[1].Sequence != 2 {
+			t.Errorf("incorrect first page %+v", changes)
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest(api_url+"changes?limit=2&since=2"))
+
+		assertResponseBody(t, response.Header().Get(lastSequenceHeader), "3")
+		if changes := getChangesFromResponse(t, response); len(changes) != 1 || changes[0].Sequence != 3 {
+			t.Errorf("incorrect last page %+v", changes)
+		}
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest(api_url+"changes?since=3"))
+
+		assertResponseBody(t, response.Header().Get(lastSequenceHeader), "3")
+		assertResponseBody(t, response.Body.String(), "[]\n")
+	})
+
+	t.Run("Changes request should never return more than maxChangesLimit changes", func(t *testing.T) {
+		previousLimit := maxChangesLimit
+		maxChangesLimit = 1
+		defer func() { maxChangesLimit = previousLimit }()
+
+		store = &StubEventStore{spy: &Spy{}}
+		server.ServeHTTP(httptest.NewRecorder(), newPostRequestTo(api_url, withoutIds(validEvent1, validEvent2)))
+
+		for _, target := range []string{api_url + "changes", api_url + "changes?limit=50"} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newGetRequest(target))
+
+			if changes := getChangesFromResponse(t, response); len(changes) != 1 {
+				t.Errorf("%s: expected a single change, got %+v", target, changes)
+			}
+		}
+	})
+
+	t.Run("Changes request should resume after the hidden changes ending a page", func(t *testing.T) {
+		store = &StubEventStore{flags: []Flag{antiCheatFlag}, apiKeys: roleAPIKeys(), changes: []Change{
+			{Sequence: 1, Type: changeCreated, Event: validEvent1},
+			{Sequence: 2, Type: changeCreated, Event: antiCheatEvent},
+		}}
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newGetRequest(api_url+"changes?limit=2"), "client-key")
+
+		assertResponseBody(t, response.Header().Get(lastSequenceHeader), "2")
+		assertChanges(t, getChangesFromResponse(t, response), []Change{{Sequence: 1, Type: changeCreated, Event: validEvent1}})
+	})
+
+	t.Run("Changes request should return status code 422 when limit is invalid", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		for _, limit := range []string{"a", "0", "-1"} {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newGetRequest(api_url+"changes?limit="+limit))
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+}
+
+// Helpers
+func assertChanges(t *testing.T, got, want []Change) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("changes are different:\ngot %+v\nwant %+v", got, want)
+	}
+
+	for i := range got {
+		sameTimestamp := got[i].Event.Timestamp.Equal(want[i].Event.Timestamp)
+		got[i].Event.Timestamp = want[i].Event.Timestamp
+
+		if !sameTimestamp || !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("changes are different:\ngot %+v\nwant %+v", got, want)
+		}
+	}
+}
+
+func getChangesFromResponse(t *testing.T, response *httptest.ResponseRecorder) (changes []Change) {
+	t.Helper()
+
+	err := json.NewDecoder(response.Body).Decode(&changes)
+
+	if err != nil {
+		t.Fatalf("unable to parse response from server %q into changes: %v", response.Body, err)
+	}
+
+	return
+}
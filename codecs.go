@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const msgpackContentType = "application/msgpack"
+
+type jsonCodec struct{}
+
+func (c jsonCodec) contentType() string {
+	return jsonContentType
+}
+
+func (c jsonCodec) encodeEvent(event Event) ([]byte, error) {
+	return encodeJsonLine(&event)
+}
+
+func (c jsonCodec) encodeEventList(eventList []Event) ([]byte, error) {
+	return encodeJsonLine(&eventList)
+}
+
+func (c jsonCodec) decodeEventList(data []byte) (eventList []Event, err error) {
+	eventList = []Event{}
+	err = decodeJson(data, &eventList)
+	return
+}
+
+func encodeJsonLine(content interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := json.NewEncoder(&buffer).Encode(content)
+	return buffer.Bytes(), err
+}
+
+// msgpackCodec reuses the json tags so that both encodings share the same keys
+type msgpackCodec struct{}
+
+func (c msgpackCodec) contentType() string {
+	return msgpackContentType
+}
+
+func (c msgpackCodec) encodeEvent(event Event) ([]byte, error) {
+	return encodeMsgpack(&event)
+}
+
+func (c msgpackCodec) encodeEventList(eventList []Event) ([]byte, error) {
+	return encodeMsgpack(&eventList)
+}
+
+func (c msgpackCodec) decodeEventList(data []byte) (eventList []Event, err error) {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+
+	eventList = []Event{}
+	err = decoder.Decode(&eventList)
+	return
+}
+
+func encodeMsgpack(content interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+
+	err := encoder.Encode(content)
+	return buffer.Bytes(), err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestContentNegotiation(t *testing.T) {
+	store = &StubEventStore{events: []Event{validEvent1, validEvent2}}
+
+	t.Run("Get request should return event as protobuf when accepted", func(t *testing.T) {
+		request := newGetRequest(api_url + "1")
+		request.Header.Set("accept", protobufContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got, err := decodeProtobufEvent(response.Body.Bytes())
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, protobufContentType)
+		assertNoError(t, err)
+		assertEvent(t, got, validEvent1)
+	})
+
+	t.Run("Get request should return event list as MessagePack when accepted", func(t *testing.T) {
+		request := newGetRequest(api_url)
+		request.Header.Set("accept", "text/html, "+msgpackContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got, err := msgpackCodec{}.decodeEventList(response.Body.Bytes())
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, msgpackContentType)
+		assertNoError(t, err)
+		assertEventListEqual(t, got, []Event{validEvent1, validEvent2})
+	})
+
+	t.Run("Get request should fall back to JSON for unknown media types", func(t *testing.T) {
+		request := newGetRequest(api_url + "getFlag/7")
+		request.Header.Set("accept", "application/xml")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+	})
+
+	t.Run("Post request should accept protobuf and MessagePack bodies", func(t *testing.T) {
+		for _, codec := range []eventCodec{protobufCodec{}, msgpackCodec{}} {
+			spy := &Spy{}
+			store = &StubEventStore{spy: spy}
+
+			body, _ := codec.encodeEventList([]Event{validEvent1, invalidEvent1, validEvent2})
+			request, _ := http.NewRequest(http.MethodPost, api_url, bytes.NewReader(body))
+			request.Header.Set("content-type", codec.contentType())
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertEventListEqual(t, spy.listGivenAsParameter, []Event{validEvent1, validEvent2})
+		}
+	})
+}
+
+func TestProtobufCodec(t *testing.T) {
+	t.Run("event lists should survive a round trip", func(t *testing.T) {
+		eventList := []Event{validEvent1, validEvent2, {Id: -3, Timestamp: time.Date(1960, 1, 1, 0, 0, 0, 5, time.UTC), Flags: []int{-1}}}
+
+		data, _ := protobufCodec{}.encodeEventList(eventList)
+		got, err := protobufCodec{}.decodeEventList(data)
+
+		assertNoError(t, err)
+		assertEventListEqual(t, got, eventList)
+	})
+
+	t.Run("timestamp should be encoded as google.protobuf.Timestamp", func(t *testing.T) {
+		data := appendProtobufEvent(nil, validEvent1)
+
+		var message []byte
+		_ = consumeProtobufFields(data, func(number protowire.Number, fieldType protowire.Type, value []byte) (int, error) {
+			if number == eventTimestampField {
+				var n int
+				message, n = protowire.ConsumeBytes(value)
+				return n, nil
+			}
+			return skipProtobufField(number, fieldType, value)
+		})
+
+		timestamp := &timestamppb.Timestamp{}
+		assertNoError(t, proto.Unmarshal(message, timestamp))
+
+		if !timestamp.AsTime().Equal(validEvent1.Timestamp) {
+			t.Errorf("incorrect timestamp: got %v, want %v", timestamp.AsTime(), validEvent1.Timestamp)
+		}
+	})
+
+	t.Run("unpacked flags and unknown fields should be accepted", func(t *testing.T) {
+		var data []byte
+		data = protowire.AppendTag(data, eventFlagsField, protowire.VarintType)
+		data = protowire.AppendVarint(data, 7)
+		data = protowire.AppendTag(data, 15, protowire.BytesType)
+		data = protowire.AppendString(data, "ignored")
+		data = protowire.AppendTag(data, eventFlagsField, protowire.VarintType)
+		data = protowire.AppendVarint(data, 2)
+
+		got, err := decodeProtobufEvent(data)
+
+		assertNoError(t, err)
+		assertEvent(t, got, Event{Flags: []int{7, 2}})
+	})
+
+	t.Run("truncated messages should be rejected", func(t *testing.T) {
+		data, _ := protobufCodec{}.encodeEventList([]Event{validEvent1})
+
+		if _, err := (protobufCodec{}).decodeEventList(data[:len(data)-3]); err == nil {
+			t.Errorf("expected an error for a truncated message")
+		}
+	})
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	data, _ := msgpackCodec{}.encodeEvent(validEvent1)
+
+	got := map[string]interface{}{}
+	_ = msgpack.Unmarshal(data, &got)
+
+	for _, key := range []string{"id", "timestamp", "flags", "data"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("MessagePack encoding should use json key %q, got %v", key, got)
+		}
+	}
+}
+
+// Helpers
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// assertEventListEqual compares timestamps by instant, as decoding may change their location
+func assertEventListEqual(t *testing.T, got, want []Event) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("event lists are different:\ngot %v\nwant %v", got, want)
+	}
+
+	for i := range got {
+		gotEvent, wantEvent := got[i], want[i]
+		if !gotEvent.Timestamp.Equal(wantEvent.Timestamp) {
+			t.Errorf("event lists are different:\ngot %v\nwant %v", got, want)
+		}
+
+		gotEvent.Timestamp, wantEvent.Timestamp = time.Time{}, time.Time{}
+		assertEvent(t, gotEvent, wantEvent)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	collections_url   = "/api/admin/collections/"
+	defaultController = "game-event"
+	defaultTable      = "game_event"
+	defaultLimit      = 500
+)
+
+var reservedControllers = []string{"admin", "flags"}
+var controllerPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+var tablePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+type Collection struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	Limit int    `json:"limit"`
+}
+
+var newCollectionStore = func(collection Collection) EventStore {
+	return PostGreStore{table: collection.Table, limit: collection.Limit}
+}
+
+var collectionStores = struct {
+	sync.RWMutex
+	stores map[string]EventStore
+}{stores: map[string]EventStore{}}
+
+func withEventStore(handler func(http.ResponseWriter, *http.Request, EventStore)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventStore, ok := getEventStore(mux.Vars(r)["controller"])
+
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		eventStore = eventStore.ForTenant(getTenant(r))
+
+		if hiddenFlags := getHiddenFlags(r); len(hiddenFlags) > 0 {
+			eventStore = flagFilteredStore{EventStore: eventStore, hiddenFlags: hiddenFlags}
+		}
+
+		handler(w, r, eventStore)
+	}
+}
+
+// The default controller always uses the main store, other collections get their own store
+func getEventStore(controller string) (EventStore, bool) {
+	if controller == defaultController {
+		return store, true
+	}
+
+	collectionStores.RLock()
+	defer collectionStores.RUnlock()
+
+	eventStore, ok := collectionStores.stores[controller]
+	return eventStore, ok
+}
+
+func forEachEventStore(apply func(eventStore EventStore)) {
+	collectionStores.RLock()
+	eventStores := []EventStore{store}
+	for _, eventStore := range collectionStores.stores {
+		eventStores = append(eventStores, eventStore)
+	}
+	collectionStores.RUnlock()
+
+	for _, eventStore := range eventStores {
+		apply(eventStore)
+	}
+}
+
+func loadCollections() {
+	for _, collection := range store.GetAllCollections() {
+		openCollection(collection)
+	}
+}
+
+func openCollection(collection Collection) {
+	collectionStores.Lock()
+	defer collectionStores.Unlock()
+
+	collectionStores.stores[collection.Name] = newCollectionStore(collection)
+}
+
+func closeCollection(name string) {
+	collectionStores.Lock()
+	defer collectionStores.Unlock()
+
+	delete(collectionStores.stores, name)
+}
+
+func getAllCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	collectionList := append([]Collection{getDefaultCollection()}, store.GetAllCollections()...)
+
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &collectionList)
+}
+
+func postCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, err := getCollectionFromRequest(r)
+
+	if err != nil || !isValidCollection(collection) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, exists := getEventStore(collection.Name); exists || isUsedTable(collection.Table) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	affectedLines, err := auditAction(r, map[string]string{"name": collection.Name, "table": collection.Table}, func() int { return store.RegisterCollection(collection) })
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if affectedLines > 0 {
+		openCollection(collection)
+	}
+
+	_, _ = w.Write(formatLineNumberResponse(affectedLines))
+}
+
+func deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if name == defaultController {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	affectedLines, err := auditAction(r, nil, func() int { return store.DeleteCollection(name) })
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	closeCollection(name)
+
+	_, _ = w.Write(formatLineNumberResponse(affectedLines))
+}
+
+func getDefaultCollection() Collection {
+	return Collection{Name: defaultController, Table: defaultTable, Limit: defaultLimit}
+}
+
+// isUsedTable prevents two collections from sharing a table, which would mix their events
+func isUsedTable(table string) bool {
+	for _, collection := range append(store.GetAllCollections(), getDefaultCollection()) {
+		if collection.Table == table {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getCollectionFromRequest(r *http.Request) (collection Collection, err error) {
+	dataSent, _ := ioutil.ReadAll(r.Body)
+	if err = json.Unmarshal(dataSent, &collection); err != nil {
+		return
+	}
+
+	if collection.Table == "" {
+		collection.Table = strings.ReplaceAll(collection.Name, "-", "_")
+	}
+	if collection.Limit == 0 {
+		collection.Limit = defaultLimit
+	}
+
+	return
+}
+
+func isValidCollection(collection Collection) bool {
+	for _, reserved := range reservedControllers {
+		if collection.Name == reserved {
+			return false
+		}
+	}
+
+	return controllerPattern.MatchString(collection.Name) &&
+		tablePattern.MatchString(collection.Table) &&
+		collection.Limit > 0
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCollectionRouting(t *testing.T) {
+	telemetryStore := &StubEventStore{events: []Event{validEvent4}}
+	useCollectionStores(t, map[string]EventStore{"telemetry": telemetryStore})
+	store = &StubEventStore{events: []Event{validEvent1}}
+
+	t.Run("Get request should use the store of the requested collection", func(t *testing.T) {
+		request := newGetRequest("/api/telemetry/4")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertEvent(t, getEventFromResponse(t, response.Body), validEvent4)
+	})
+
+	t.Run("Default collection should keep using the main store", func(t *testing.T) {
+		request := newGetRequest(api_url + "4")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("Post request should register events in the requested collection", func(t *testing.T) {
+		spy := &Spy{}
+		telemetryStore.spy = spy
+
+		request := newPostRequestTo("/api/telemetry/", []Event{validEvent2})
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertCalledFunction(t, spy.calledFunction, registerFunctionName)
+		assertEventList(t, spy.listGivenAsParameter, []Event{validEvent2})
+	})
+
+	t.Run("Requests should return status code 404 when collection does not exist", func(t *testing.T) {
+		for _, request := range []*http.Request{newGetRequest("/api/audit/"), newGetRequest("/api/audit/1"), newDeleteRequest("/api/audit/deleteflag/2")} {
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestCollectionAdministration(t *testing.T) {
+	t.Run("Post request should create the collection with default configuration", func(t *testing.T) {
+		stub := &StubEventStore{}
+		store = stub
+		useCollectionStores(t, map[string]EventStore{})
+
+		request := newRequestWithBody(http.MethodPost, collections_url, Collection{Name: "audit-log"})
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), fmt.Sprintf("{\"%s\":%d}", lineNumberResponseKey, 1))
+		assertCollectionList(t, stub.collections, []Collection{{Name: "audit-log", Table: "audit_log", Limit: defaultLimit}})
+
+		request = newGetRequest("/api/audit-log/")
+		response = httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("Post request should return status code 409 when collection already exists", func(t *testing.T) {
+		store = &StubEventStore{}
+		useCollectionStores(t, map[string]EventStore{"telemetry": &StubEventStore{}})
+
+		for _, name := range []string{"telemetry", defaultController} {
+			request := newRequestWithBody(http.MethodPost, collections_url, Collection{Name: name})
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("Post request should return status code 409 when table is already used", func(t *testing.T) {
+		stub := &StubEventStore{collections: []Collection{{Name: "telemetry", Table: "telemetry", Limit: defaultLimit}}}
+		store = stub
+		useCollectionStores(t, map[string]EventStore{"telemetry": &StubEventStore{}})
+
+		for _, table := range []string{"telemetry", defaultTable} {
+			request := newRequestWithBody(http.MethodPost, collections_url, Collection{Name: "metrics", Table: table})
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusConflict)
+		}
+
+		if _, ok := getEventStore("metrics"); ok || len(stub.collections) != 1 {
+			t.Errorf("collection metrics should not be created")
+		}
+	})
+
+	t.Run("Post request should return status code 422 when collection is invalid", func(t *testing.T) {
+		store = &StubEventStore{}
+		useCollectionStores(t, map[string]EventStore{})
+
+		invalidCollections := []Collection{{}, {Name: "flags"}, {Name: "admin"}, {Name: "Telemetry"}, {Name: "telemetry", Table: "events; drop table"}, {Name: "telemetry", Limit: -1}}
+
+		for _, collection := range invalidCollections {
+			request := newRequestWithBody(http.MethodPost, collections_url, collection)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("Get request should list the default collection and registered collections", func(t *testing.T) {
+		telemetry := Collection{Name: "telemetry", Table: "telemetry", Limit: 1000}
+		store = &StubEventStore{collections: []Collection{telemetry}}
+
+		request := newGetRequest(collections_url)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := []Collection{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertCollectionList(t, got, []Collection{getDefaultCollection(), telemetry})
+	})
+
+	t.Run("Delete request should stop routing to the collection", func(t *testing.T) {
+		store = &StubEventStore{collections: []Collection{{Name: "telemetry", Table: "telemetry", Limit: 500}}}
+		useCollectionStores(t, map[string]EventStore{"telemetry": &StubEventStore{}})
+
+		request := newDeleteRequest(collections_url + "telemetry")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), fmt.Sprintf("{\"%s\":%d}", lineNumberResponseKey, 1))
+
+		request = newGetRequest("/api/telemetry/")
+		response = httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("Delete request should return status code 422 for the default collection", func(t *testing.T) {
+		request := newDeleteRequest(collections_url + defaultController)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+}
+
+func TestLoadCollections(t *testing.T) {
+	telemetry := Collection{Name: "telemetry", Table: "telemetry", Limit: 1000}
+	store = &StubEventStore{collections: []Collection{telemetry}}
+	useCollectionStores(t, map[string]EventStore{})
+
+	var opened []Collection
+	newCollectionStore = func(collection Collection) EventStore {
+		opened = append(opened, collection)
+		return &StubEventStore{}
+	}
+
+	loadCollections()
+
+	assertCollectionList(t, opened, []Collection{telemetry})
+	if _, ok := getEventStore("telemetry"); !ok {
+		t.Errorf("collection telemetry should be routed after loading")
+	}
+}
+
+// Helpers
+func assertCollectionList(t *testing.T, got, want []Collection) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collection lists are different:\ngot %v\nwant %v", got, want)
+	}
+}
+
+// useCollectionStores replaces the opened collections for the duration of the test
+func useCollectionStores(t *testing.T, stores map[string]EventStore) {
+	t.Helper()
+
+	previousStores := collectionStores.stores
+	previousFactory := newCollectionStore
+
+	collectionStores.stores = stores
+	newCollectionStore = func(collection Collection) EventStore {
+		return &StubEventStore{}
+	}
+
+	t.Cleanup(func() {
+		collectionStores.stores = previousStores
+		newCollectionStore = previousFactory
+	})
+}
+
+func newPostRequestTo(target string, eventList []Event) *http.Request {
+	return newRequestWithBody(http.MethodPost, target, eventList)
+}
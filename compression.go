@@ -0,0 +1,190 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	gzipEncoding = "gzip"
+	zstdEncoding = "zstd"
+)
+
+var maxDecompressedSize int64 = 100 << 20
+
+// zstdMaxWindow bounds the window a zstd frame may declare, the decoder allocating it whatever
+// the size of the body. Decoders run on the request goroutine instead of one per CPU
+const zstdMaxWindow = 8 << 20
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// Encodings offered for responses, by order of preference
+var responseEncodings = []string{zstdEncoding, gzipEncoding}
+
+// decompressionMiddleware decodes gzip and zstd request bodies, stopping at maxDecompressedSize
+// so that a small compressed body cannot expand without bound
+func decompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("content-encoding")))
+		if encoding == "" || encoding == "identity" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := newDecompressedBody(encoding, r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		defer body.Close()
+
+		r.Body = &limitedBody{ReadCloser: body, remaining: maxDecompressedSize}
+		r.Header.Del("content-encoding")
+		r.Header.Del("content-length")
+		r.ContentLength = -1
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newDecompressedBody(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case gzipEncoding:
+		return gzip.NewReader(body)
+	case zstdEncoding:
+		decoder, err := zstd.NewReader(body, zstd.WithDecoderMaxWindow(zstdMaxWindow), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	return nil, errors.New("unsupported content encoding " + encoding)
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		var probe [1]byte
+		if n, _ := l.ReadCloser.Read(probe[:]); n > 0 {
+			return 0, errBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+func compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("accept-encoding"))
+		// An upgraded connection needs the original writer to be hijacked
+		if encoding == "" || r.Header.Get("upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		compressedWriter := &compressResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer compressedWriter.Close()
+
+		next.ServeHTTP(compressedWriter, r)
+	})
+}
+
+// negotiateEncoding returns the preferred encoding accepted by the client, if any
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+
+	for _, value := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(value, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		accepted[name] = true
+
+		for _, parameter := range parts[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+			if q, err := strconv.ParseFloat(value, 64); key == "q" && err == nil && q == 0 {
+				accepted[name] = false
+			}
+		}
+	}
+
+	for _, encoding := range responseEncodings {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	writer      io.WriteCloser
+	wroteHeader bool
+}
+
+func (c *compressResponseWriter) WriteHeader(statusCode int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	header := c.Header()
+	header.Add("vary", "Accept-Encoding")
+
+	if statusCode != http.StatusNoContent && statusCode != http.StatusNotModified {
+		header.Set("content-encoding", c.encoding)
+		header.Del("content-length")
+		c.writer = newCompressedWriter(c.encoding, c.ResponseWriter)
+	}
+
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (c *compressResponseWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.writer == nil {
+		return c.ResponseWriter.Write(p)
+	}
+	return c.writer.Write(p)
+}
+
+func (c *compressResponseWriter) Flush() {
+	if flusher, ok := c.writer.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	flush(c.ResponseWriter)
+}
+
+func (c *compressResponseWriter) Close() error {
+	if c.writer == nil {
+		return nil
+	}
+	return c.writer.Close()
+}
+
+func newCompressedWriter(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == zstdEncoding {
+		encoder, _ := zstd.NewWriter(w)
+		return encoder
+	}
+	return gzip.NewWriter(w)
+}
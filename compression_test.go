@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressedRequest(t *testing.T) {
+	eventList := []Event{validEvent1, validEvent2}
+	body, _ := json.Marshal(eventList)
+
+	t.Run("Post request should accept gzip and zstd bodies", func(t *testing.T) {
+		for _, encoding := range []string{gzipEncoding, zstdEncoding} {
+			spy := &Spy{}
+			store = &StubEventStore{spy: spy}
+
+			request := newCompressedPostRequest(api_url, encoding, body)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertEventList(t, spy.listGivenAsParameter, eventList)
+		}
+	})
+
+	t.Run("Post request should return status code 413 when decompressed body is too large", func(t *testing.T) {
+		useMaxDecompressedSize(t, 1024)
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+
+		bomb := []byte("[" + strings.Repeat(" ", 1<<20) + "]")
+
+		request := newCompressedPostRequest(api_url, gzipEncoding, bomb)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+		assertCalledFunction(t, spy.calledFunction, "")
+	})
+
+	t.Run("NDJSON post request should return status code 413 when decompressed body is too large", func(t *testing.T) {
+		useMaxDecompressedSize(t, 1024)
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+
+		lines := strings.Repeat(toJsonLine(validEvent2)+"\n", 100)
+
+		request := newCompressedPostRequest(api_url, zstdEncoding, []byte(lines))
+		request.Header.Set("content-type", ndjsonContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("Post request should be rejected when the zstd window exceeds the decoder limit", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+
+		request, _ := http.NewRequest(http.MethodPost, api_url, bytes.NewReader(newZstdFrameWithWindow(26, body)))
+		request.Header.Set("content-encoding", zstdEncoding)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		assertCalledFunction(t, spy.calledFunction, "")
+	})
+
+	t.Run("Post request should return status code 415 for unsupported encodings", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+
+		request := newCompressedPostRequest(api_url, "br", body)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnsupportedMediaType)
+	})
+}
+
+func TestCompressedResponse(t *testing.T) {
+	store = &StubEventStore{events: []Event{validEvent1, validEvent2}}
+
+	eventListAsJson, _ := json.Marshal([]Event{validEvent1, validEvent2})
+	want := string(eventListAsJson) + "\n"
+
+	t.Run("Get request should compress response with gzip when accepted", func(t *testing.T) {
+		request := newGetRequest(api_url)
+		request.Header.Set("accept-encoding", "gzip, deflate")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHeader(t, response, "content-encoding", gzipEncoding)
+		assertResponseBody(t, decompress(t, gzipEncoding, response.Body), want)
+	})
+
+	t.Run("Get request should prefer zstd when both encodings are accepted", func(t *testing.T) {
+		request := newGetRequest(api_url)
+		request.Header.Set("accept-encoding", "gzip, zstd")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHeader(t, response, "content-encoding", zstdEncoding)
+		assertResponseBody(t, decompress(t, zstdEncoding, response.Body), want)
+	})
+
+	t.Run("Get request should not compress response when encodings are refused", func(t *testing.T) {
+		request := newGetRequest(api_url)
+		request.Header.Set("accept-encoding", "zstd;q=0, gzip; q=0.0, br")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHeader(t, response, "content-encoding", "")
+		assertResponseBody(t, response.Body.String(), want)
+	})
+}
+
+// Helpers
+func assertHeader(t *testing.T, response *httptest.ResponseRecorder, name, want string) {
+	t.Helper()
+
+	if got := response.Result().Header.Get(name); got != want {
+		t.Errorf("incorrect header %s: got %q, want %q", name, got, want)
+	}
+}
+
+func newCompressedPostRequest(target, encoding string, body []byte) *http.Request {
+	var buffer bytes.Buffer
+
+	switch encoding {
+	case gzipEncoding:
+		writer := gzip.NewWriter(&buffer)
+		_, _ = writer.Write(body)
+		_ = writer.Close()
+	case zstdEncoding:
+		writer, _ := zstd.NewWriter(&buffer)
+		_, _ = writer.Write(body)
+		_ = writer.Close()
+	default:
+		buffer.Write(body)
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, target, &buffer)
+	request.Header.Set("content-encoding", encoding)
+	return request
+}
+
+func decompress(t *testing.T, encoding string, body io.Reader) string {
+	t.Helper()
+
+	reader, err := newDecompressedBody(encoding, body)
+	if err != nil {
+		t.Fatalf("unable to decompress response: %v", err)
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unable to decompress response: %v", err)
+	}
+
+	return string(content)
+}
+
+func useMaxDecompressedSize(t *testing.T, size int64) {
+	t.Helper()
+
+	previousSize := maxDecompressedSize
+	maxDecompressedSize = size
+	t.Cleanup(func() { maxDecompressedSize = previousSize })
+}
+
+// newZstdFrameWithWindow writes body as a raw block of a frame declaring a window of 2^windowLog
+// bytes, encoders shrinking the window of small inputs
+func newZstdFrameWithWindow(windowLog int, body []byte) []byte {
+	blockHeader := len(body)<<3 | 1
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, byte((windowLog - 10) << 3)}
+	frame = append(frame, byte(blockHeader), byte(blockHeader>>8), byte(blockHeader>>16))
+
+	return append(frame, body...)
+}
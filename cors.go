@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	originHeader             = "Origin"
+	requestMethodHeader      = "Access-Control-Request-Method"
+	allowOriginHeader        = "Access-Control-Allow-Origin"
+	allowMethodsHeader       = "Access-Control-Allow-Methods"
+	allowHeadersHeader       = "Access-Control-Allow-Headers"
+	allowCredentialsHeader   = "Access-Control-Allow-Credentials"
+	exposeHeadersHeader      = "Access-Control-Expose-Headers"
+	maxAgeHeader             = "Access-Control-Max-Age"
+	anyOrigin                = "*"
+	preflightRoutePathPrefix = "/api/"
+)
+
+var (
+	corsAllowedOrigins []string
+	corsAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	corsAllowedHeaders = []string{"Authorization", "Content-Type", "Content-Encoding", apiKeyHeader, lastEventIdHeader}
+	corsExposedHeaders = []string{retryAfterHeader, "WWW-Authenticate", lastSequenceHeader}
+	corsMaxAge         = 600
+)
+
+// corsMiddleware runs before authentication: preflight requests carry no credentials and are answered here
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(originHeader)
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowedOrigin, allowed := getAllowedOrigin(origin)
+		if allowed {
+			setCorsHeaders(w, allowedOrigin)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get(requestMethodHeader) != "" {
+			if allowed {
+				w.Header().Set(allowMethodsHeader, strings.Join(corsAllowedMethods, ", "))
+				w.Header().Set(allowHeadersHeader, strings.Join(corsAllowedHeaders, ", "))
+				w.Header().Set(maxAgeHeader, strconv.Itoa(corsMaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setCorsHeaders only allows credentials for a listed origin, which is echoed: any site may
+// read the responses when "*" is allowed, so they must not be sent with the user's credentials
+func setCorsHeaders(w http.ResponseWriter, origin string) {
+	w.Header().Set(allowOriginHeader, origin)
+	if origin != anyOrigin {
+		w.Header().Set(allowCredentialsHeader, "true")
+		w.Header().Add("Vary", originHeader)
+	}
+	w.Header().Set(exposeHeadersHeader, strings.Join(corsExposedHeaders, ", "))
+}
+
+// getAllowedOrigin returns the value of the Access-Control-Allow-Origin header for the origin,
+// "*" whenever it is listed
+func getAllowedOrigin(origin string) (string, bool) {
+	allowed := false
+
+	for _, allowedOrigin := range corsAllowedOrigins {
+		if allowedOrigin == anyOrigin {
+			return anyOrigin, true
+		}
+		allowed = allowed || strings.EqualFold(allowedOrigin, origin)
+	}
+
+	return origin, allowed
+}
+
+// preflightHandler only matches OPTIONS requests which are not preflights, corsMiddleware answering the others
+func preflightHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", strings.Join(append([]string{http.MethodOptions}, corsAllowedMethods...), ", "))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseHeaderList(value string) (list []string) {
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	t.Run("Preflight request should be answered for an allowed origin without authentication", func(t *testing.T) {
+		store = &StubEventStore{}
+		useCorsAllowedOrigins(t, "https://dashboard.example.com")
+		useAuthentication(t, "")
+
+		for _, target := range []string{api_url, api_url + "1", api_url + "getFlag/2", flags_url, webhooks_url + "1/deliveries"} {
+			request := newPreflightRequest(target, "https://dashboard.example.com", http.MethodDelete)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusNoContent)
+			assertHeader(t, response, allowOriginHeader, "https://dashboard.example.com")
+			assertHeader(t, response, allowCredentialsHeader, "true")
+			assertHeader(t, response, allowMethodsHeader, "GET, POST, PUT, DELETE")
+			assertHeader(t, response, allowHeadersHeader, "Authorization, Content-Type, Content-Encoding, X-API-Key, Last-Event-ID")
+			assertHeader(t, response, maxAgeHeader, "600")
+		}
+	})
+
+	t.Run("Preflight request should not allow an unknown origin", func(t *testing.T) {
+		useCorsAllowedOrigins(t, "https://dashboard.example.com")
+
+		request := newPreflightRequest(api_url, "https://evil.example.com", http.MethodGet)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		assertHeader(t, response, allowOriginHeader, "")
+		assertHeader(t, response, allowMethodsHeader, "")
+	})
+
+	t.Run("Requests from an allowed origin should carry CORS headers, errors included", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}}
+		useCorsAllowedOrigins(t, "https://admin.example.com, https://dashboard.example.com")
+
+		request := newGetRequest(api_url + "1")
+		request.Header.Set(originHeader, "https://dashboard.example.com")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHeader(t, response, allowOriginHeader, "https://dashboard.example.com")
+		assertHeader(t, response, allowCredentialsHeader, "true")
+		assertHeader(t, response, exposeHeadersHeader, "Retry-After, WWW-Authenticate, X-Last-Sequence")
+
+		useAuthentication(t, "")
+		request = newGetRequest(api_url + "1")
+		request.Header.Set(originHeader, "https://dashboard.example.com")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertHeader(t, response, allowOriginHeader, "https://dashboard.example.com")
+	})
+
+	t.Run("Requests should be allowed from any origin without credentials when * is listed", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}}
+		useCorsAllowedOrigins(t, "https://dashboard.example.com, "+anyOrigin)
+
+		for _, origin := range []string{"https://dashboard.example.com", "https://evil.example.com"} {
+			request := newGetRequest(api_url + "1")
+			request.Header.Set(originHeader, origin)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertHeader(t, response, allowOriginHeader, anyOrigin)
+			assertHeader(t, response, allowCredentialsHeader, "")
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPreflightRequest(api_url, "https://evil.example.com", http.MethodGet))
+
+		assertHeader(t, response, allowOriginHeader, anyOrigin)
+		assertHeader(t, response, allowCredentialsHeader, "")
+	})
+
+	t.Run("Requests without Origin should not carry CORS headers", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}}
+		useCorsAllowedOrigins(t, anyOrigin)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest(api_url+"1"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHeader(t, response, allowOriginHeader, "")
+	})
+}
+
+// Helpers
+func useCorsAllowedOrigins(t *testing.T, origins string) {
+	t.Helper()
+
+	previousOrigins := corsAllowedOrigins
+	corsAllowedOrigins = parseHeaderList(origins)
+	t.Cleanup(func() { corsAllowedOrigins = previousOrigins })
+}
+
+func newPreflightRequest(target, origin, method string) *http.Request {
+	request, _ := http.NewRequest(http.MethodOptions, target, nil)
+	request.Header.Set(originHeader, origin)
+	request.Header.Set(requestMethodHeader, method)
+	return request
+}
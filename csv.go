@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	csvContentType    = "text/csv"
+	csvFlagsSeparator = "|"
+)
+
+var csvHeader = []string{"id", "timestamp", "flags", "data"}
+
+func streamCSV(w http.ResponseWriter, iterate eventIterator) {
+	writer := csv.NewWriter(w)
+	if writer.Write(csvHeader) != nil {
+		return
+	}
+
+	written := 0
+
+	iterate(func(event Event) bool {
+		if writer.Write(formatCSVRecord(event)) != nil {
+			return false
+		}
+
+		written++
+		if written%streamFlushInterval == 0 {
+			writer.Flush()
+			flush(w)
+		}
+		return writer.Error() == nil
+	})
+
+	writer.Flush()
+	flush(w)
+}
+
+func formatCSVRecord(event Event) []string {
+	flags := make([]string, len(event.Flags))
+	for i, flag := range event.Flags {
+		flags[i] = strconv.Itoa(flag)
+	}
+
+	timestamp := ""
+	if !event.Timestamp.IsZero() {
+		timestamp = event.Timestamp.Format(time.RFC3339Nano)
+	}
+
+	return []string{strconv.Itoa(event.Id), timestamp, strings.Join(flags, csvFlagsSeparator), event.Data}
+}
+
+func postCSVHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	body := newRecordLimitedBody(r.Body)
+	reader := csv.NewReader(body)
+
+	header, err := reader.Read()
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	columns, err := getCSVColumns(header)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	batcher := newEventBatcher(eventStore, mux.Vars(r)["controller"], getClientId(r), getTenant(r))
+	var readErr error
+
+	for {
+		record, err := reader.Read()
+		body.reset()
+		if err == io.EOF {
+			break
+		}
+
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			batcher.reject(parseError.Line, parseError.Err.Error())
+			continue
+		} else if err != nil {
+			readErr = err
+			batcher.reject(0, fmt.Sprintf("unable to read body: %v", err))
+			break
+		}
+
+		lineNumber, _ := reader.FieldPos(0)
+
+		if event, err := parseCSVRecord(record, columns); err != nil {
+			batcher.reject(lineNumber, err.Error())
+		} else {
+			batcher.add(lineNumber, event)
+		}
+	}
+
+	batcher.writeSummary(w, readErr)
+}
+
+// getCSVColumns maps each expected column to its position in the header, in any order
+func getCSVColumns(header []string) (map[string]int, error) {
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range csvHeader {
+		if _, ok := columns[name]; !ok {
+			return nil, errMissingParameter(name)
+		}
+	}
+
+	return columns, nil
+}
+
+func parseCSVRecord(record []string, columns map[string]int) (event Event, err error) {
+	if id := record[columns["id"]]; id != "" {
+		if event.Id, err = strconv.Atoi(id); err != nil {
+			return event, fmt.Errorf("invalid id %q", id)
+		}
+	}
+
+	if timestamp := record[columns["timestamp"]]; timestamp != "" {
+		if event.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			return event, fmt.Errorf("invalid timestamp %q", timestamp)
+		}
+	}
+
+	if flags := record[columns["flags"]]; flags != "" {
+		for _, value := range strings.Split(flags, csvFlagsSeparator) {
+			flag, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return event, fmt.Errorf("invalid flag %q", value)
+			}
+			event.Flags = append(event.Flags, flag)
+		}
+	}
+
+	event.Data = record[columns["data"]]
+	return
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVExport(t *testing.T) {
+	store = &StubEventStore{events: []Event{validEvent1, validEvent2, validEvent5}}
+
+	t.Run("Get request should export all events as CSV", func(t *testing.T) {
+		request := newGetRequest(api_url)
+		request.Header.Set("accept", csvContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := "id,timestamp,flags,data\n" +
+			"1,2020-11-15T23:51:08.084496744Z,7|2,\"{\"\"location\"\": \"\"FR\"\"}\"\n" +
+			"2,2020-06-07T07:52:45.000575963Z,15|2|8|5,{}\n" +
+			"5,2019-11-21T07:30:22.000658463Z,5|2,\"{\"\"Env\"\":\"\"dev\"\"}\"\n"
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, csvContentType)
+		assertResponseBody(t, response.Body.String(), want)
+	})
+
+	t.Run("Get request should export events with given flag as CSV", func(t *testing.T) {
+		request := newGetRequest(api_url + "getFlag/7")
+		request.Header.Set("accept", csvContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := "id,timestamp,flags,data\n" +
+			"1,2020-11-15T23:51:08.084496744Z,7|2,\"{\"\"location\"\": \"\"FR\"\"}\"\n"
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), want)
+	})
+}
+
+func TestCSVImport(t *testing.T) {
+	t.Run("Post request should register valid CSV rows and report invalid ones", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+		clock = MockClock{}
+
+		body := "flags,data,id,timestamp\n" +
+			"7|2,\"{\"\"location\"\": \"\"FR\"\"}\",1,2020-11-15T23:51:08.084496744Z\n" +
+			"3,\"{\"\"Age\"\":35}\",3,\n" +
+			",{},8,\n" +
+			"9,not json,9,\n" +
+			"a|2,{},10,\n" +
+			"9,{},11,yesterday\n"
+
+		request := newCSVPostRequest(api_url, body)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		event3 := validEvent3
+		event3.Timestamp = clock.Now()
+
+		want := ingestionSummary{AffectedLines: 2, Errors: []lineError{
+			{Line: 4, Errors: []string{"flags must contain at least one value"}},
+			{Line: 5, Errors: []string{"data must be a json string"}},
+			{Line: 6, Errors: []string{"invalid flag \"a\""}},
+			{Line: 7, Errors: []string{"invalid timestamp \"yesterday\""}},
+		}}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertIngestionSummary(t, getIngestionSummaryFromResponse(t, response), want)
+		assertEventList(t, spy.listGivenAsParameter, []Event{validEvent1, event3})
+	})
+
+	t.Run("Post request should report rows with a wrong number of fields", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+
+		body := "id,timestamp,flags,data\n4,,9\n"
+
+		request := newCSVPostRequest(api_url, body)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := getIngestionSummaryFromResponse(t, response)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if got.AffectedLines != 0 || len(got.Errors) != 1 || got.Errors[0].Line != 2 {
+			t.Errorf("incorrect summary: got %+v", got)
+		}
+	})
+
+	t.Run("Post request should return status code 422 when header is missing a column", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+
+		request := newCSVPostRequest(api_url, "id,timestamp,data\n1,,{}\n")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	columns, _ := getCSVColumns(csvHeader)
+
+	for _, event := range []Event{validEvent1, validEvent2, validEvent4} {
+		got, err := parseCSVRecord(formatCSVRecord(event), columns)
+
+		if err != nil || !reflect.DeepEqual(got, event) {
+			t.Errorf("event changed through CSV: got %v (%v), want %v", got, err, event)
+		}
+	}
+}
+
+// Helpers
+func newCSVPostRequest(target, body string) *http.Request {
+	request, _ := http.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	request.Header.Set("content-type", csvContentType+"; charset=utf-8")
+	return request
+}
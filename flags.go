@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const flags_url = "/api/flags/"
+
+var rejectUnregisteredFlags = false
+
+var errUnknownFlag = errors.New("unknown flag")
+
+type Flag struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Schema      string   `json:"schema,omitempty"`
+	ReadRoles   []string `json:"readroles,omitempty"`
+}
+
+func getFlagByIdHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := extractIntFromURL(r, "id")
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		flag := store.GetFlagById(id)
+		if contains(getHiddenFlags(r), flag.Id) {
+			flag = Flag{}
+		}
+		sendFlag(flag, w)
+	}
+}
+
+func getAllFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	hiddenFlags := getHiddenFlags(r)
+
+	flagList := []Flag{}
+	for _, flag := range store.GetAllFlags() {
+		if !contains(hiddenFlags, flag.Id) {
+			flagList = append(flagList, flag)
+		}
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &flagList)
+}
+
+func postFlagHandler(w http.ResponseWriter, r *http.Request) {
+	flag, err := getFlagFromRequest(r)
+
+	if err != nil || !isValidFlag(flag) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if isRegisteredFlag(flag.Id) || !isEmptyFlag(store.GetFlagByName(flag.Name)) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	affectedLines, err := auditAction(r, map[string]string{"id": strconv.Itoa(flag.Id), "name": flag.Name}, func() int { return store.RegisterFlag(flag) })
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = w.Write(formatLineNumberResponse(affectedLines))
+}
+
+func putFlagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := extractIntFromURL(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	flag, err := getFlagFromRequest(r)
+	flag.Id = id
+
+	if err != nil || !isValidFlag(flag) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !isRegisteredFlag(id) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if namesake := store.GetFlagByName(flag.Name); !isEmptyFlag(namesake) && namesake.Id != id {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	previousSchema := store.GetFlagById(id).Schema
+
+	affectedLines, err := auditAction(r, map[string]string{"name": flag.Name}, func() int { return store.UpdateFlag(flag) })
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if affectedLines > 0 && previousSchema != flag.Schema {
+		forgetSchema(previousSchema)
+	}
+
+	_, _ = w.Write(formatLineNumberResponse(affectedLines))
+}
+
+func deleteFlagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := extractIntFromURL(r, "id")
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		previousSchema := store.GetFlagById(id).Schema
+
+		affectedLines, err := auditAction(r, nil, func() int { return store.DeleteFlag(id) })
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if affectedLines > 0 {
+			forgetSchema(previousSchema)
+		}
+
+		_, _ = w.Write(formatLineNumberResponse(affectedLines))
+	}
+}
+
+func sendFlag(flag Flag, w http.ResponseWriter) {
+	if isEmptyFlag(flag) {
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		w.Header().Set("content-type", jsonContentType)
+		writeResponseBody(w, &flag)
+	}
+}
+
+func getFlagFromRequest(r *http.Request) (flag Flag, err error) {
+	dataSent, _ := ioutil.ReadAll(r.Body)
+	err = json.Unmarshal(dataSent, &flag)
+	return
+}
+
+func isEmptyFlag(flag Flag) bool {
+	return reflect.DeepEqual(flag, Flag{})
+}
+
+// A flag name must not be a number, otherwise it could not be told apart from a flag id in URLs
+func isValidFlag(flag Flag) bool {
+	name := strings.TrimSpace(flag.Name)
+	_, err := strconv.Atoi(name)
+	return name != "" && name == flag.Name && err != nil && isValidSchema(flag.Schema) && isValidRoleList(flag.ReadRoles)
+}
+
+func isRegisteredFlag(id int) bool {
+	return !isEmptyFlag(store.GetFlagById(id))
+}
+
+func getUnregisteredFlags(event Event) (unregisteredFlags []int) {
+	for _, flag := range event.Flags {
+		if !isRegisteredFlag(flag) {
+			unregisteredFlags = append(unregisteredFlags, flag)
+		}
+	}
+	return
+}
+
+func extractFlagFromURL(r *http.Request, key string) (int, error) {
+	return parseFlag(mux.Vars(r)[key])
+}
+
+// parseFlag accepts either a flag number or the name of a registered flag
+func parseFlag(value string) (int, error) {
+	if flag, err := strconv.Atoi(value); err == nil {
+		return flag, nil
+	}
+
+	flag := store.GetFlagByName(value)
+	if isEmptyFlag(flag) {
+		return 0, errUnknownFlag
+	}
+
+	return flag.Id, nil
+}
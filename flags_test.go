@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetFlagRequest(t *testing.T) {
+	store = &StubEventStore{flags: []Flag{locationFlag, achievementFlag}}
+
+	t.Run("Get request should return all registered flags", func(t *testing.T) {
+		request := newGetRequest(flags_url)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := []Flag{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+		assertFlagList(t, got, []Flag{locationFlag, achievementFlag})
+	})
+
+	t.Run("Get request should return flag with given id", func(t *testing.T) {
+		request := newGetRequest(flags_url + "12")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := Flag{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFlagList(t, []Flag{got}, []Flag{achievementFlag})
+	})
+
+	t.Run("Get request should return status code 404 when no flag with given id exists", func(t *testing.T) {
+		request := newGetRequest(flags_url + "3")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("Get request should return status code 422 when id given is not a number", func(t *testing.T) {
+		request := newGetRequest(flags_url + "location")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+}
+
+func TestPostFlagRequest(t *testing.T) {
+	t.Run("Post request should register the flag", func(t *testing.T) {
+		stub := &StubEventStore{flags: []Flag{locationFlag}}
+		store = stub
+
+		request := newRequestWithBody(http.MethodPost, flags_url, achievementFlag)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), fmt.Sprintf("{\"%s\":%d}", lineNumberResponseKey, 1))
+		assertFlagList(t, stub.flags, []Flag{locationFlag, achievementFlag})
+	})
+
+	t.Run("Post request should return status code 409 when id or name is already used", func(t *testing.T) {
+		store = &StubEventStore{flags: []Flag{locationFlag}}
+
+		for _, flag := range []Flag{{Id: 7, Name: "other"}, {Id: 3, Name: "location"}} {
+			request := newRequestWithBody(http.MethodPost, flags_url, flag)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("Post request should return status code 422 when flag is invalid", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		for _, body := range []interface{}{"not a flag", Flag{Id: 3}, Flag{Id: 3, Name: "42"}, Flag{Id: 3, Name: " padded"}} {
+			request := newRequestWithBody(http.MethodPost, flags_url, body)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+}
+
+func TestPutFlagRequest(t *testing.T) {
+	t.Run("Put request should update name and description of the flag", func(t *testing.T) {
+		stub := &StubEventStore{flags: []Flag{locationFlag, achievementFlag}}
+		store = stub
+
+		request := newRequestWithBody(http.MethodPut, flags_url+"7", Flag{Name: "country", Description: "Country of the player"})
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFlagList(t, stub.flags, []Flag{{Id: 7, Name: "country", Description: "Country of the player"}, achievementFlag})
+	})
+
+	t.Run("Put request should return status code 404 when no flag with given id exists", func(t *testing.T) {
+		store = &StubEventStore{flags: []Flag{locationFlag}}
+
+		request := newRequestWithBody(http.MethodPut, flags_url+"8", Flag{Name: "country"})
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("Put request should return status code 409 when name is used by another flag", func(t *testing.T) {
+		store = &StubEventStore{flags: []Flag{locationFlag, achievementFlag}}
+
+		request := newRequestWithBody(http.MethodPut, flags_url+"7", Flag{Name: "achievement"})
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusConflict)
+	})
+}
+
+func TestDeleteFlagRequest(t *testing.T) {
+	t.Run("Delete request should remove the flag from the catalog", func(t *testing.T) {
+		stub := &StubEventStore{flags: []Flag{locationFlag, achievementFlag}}
+		store = stub
+
+		request := newDeleteRequest(flags_url + "7")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), fmt.Sprintf("{\"%s\":%d}", lineNumberResponseKey, 1))
+		assertFlagList(t, stub.flags, []Flag{achievementFlag})
+	})
+}
+
+func TestQueryByFlagName(t *testing.T) {
+	t.Run("Get request should accept a flag name", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1, validEvent2}, flags: []Flag{locationFlag}}
+
+		request := newGetRequest(api_url + "getFlag/location")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := []Event{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertEventList(t, got, []Event{validEvent1})
+	})
+
+	t.Run("Delete request should accept a flag name", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{events: []Event{validEvent1, validEvent2}, spy: spy, flags: []Flag{locationFlag}}
+
+		request := newDeleteRequest(api_url + "deleteflag/location")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertCalledFunction(t, spy.calledFunction, deleteByFlagFunctionName)
+		assertEventList(t, store.GetAllEvents(), []Event{createNeutralEventWithId(1), validEvent2})
+	})
+}
+
+func TestRejectUnregisteredFlags(t *testing.T) {
+	rejectUnregisteredFlags = true
+	defer func() { rejectUnregisteredFlags = false }()
+
+	spy := &Spy{}
+	store = &StubEventStore{spy: spy, flags: []Flag{locationFlag, {Id: 2, Name: "session"}}}
+
+	request := newPostRequest([]Event{validEvent1, validEvent2})
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, request)
+
+	assertStatus(t, response.Code, http.StatusOK)
+	assertEventList(t, spy.listGivenAsParameter, []Event{validEvent1})
+}
+
+// Data
+var locationFlag = Flag{Id: 7, Name: "location", Description: "Location of the player"}
+var achievementFlag = Flag{Id: 12, Name: "achievement", Description: "Achievement unlocked"}
+
+// Helpers
+func assertFlagList(t *testing.T, got, want []Flag) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flag lists are different:\ngot %v\nwant %v", got, want)
+	}
+}
+
+func newRequestWithBody(method, target string, body interface{}) *http.Request {
+	requestBody, _ := json.Marshal(body)
+
+	request, _ := http.NewRequest(method, target, bytes.NewBuffer(requestBody))
+	return request
+}
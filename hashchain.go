@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	verifyFromIdParameter = "fromId"
+	verifyToIdParameter   = "toId"
+)
+
+// ChainVerification is the result of a walk of the hash chain from the event FromId to the
+// event ToId, the whole chain being walked when they are zero. Neutralized events cannot be
+// checked against their content anymore: their stored hash is trusted to carry the chain
+type ChainVerification struct {
+	FromId      int  `json:"fromid"`
+	ToId        int  `json:"toid,omitempty"`
+	Valid       bool `json:"valid"`
+	Verified    int  `json:"verified"`
+	Neutralized int  `json:"neutralized"`
+	BrokenAt    int  `json:"brokenat,omitempty"`
+}
+
+type canonicalEvent struct {
+	Id        int         `json:"id"`
+	Timestamp string      `json:"timestamp"`
+	Flags     []int       `json:"flags"`
+	Data      interface{} `json:"data"`
+	Tenant    string      `json:"tenant"`
+}
+
+func verifyChainHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	fromId, toId, err := getIdRangeFromRequest(r)
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		verification := verifyChain(eventStore, fromId, toId)
+
+		w.Header().Set("content-type", jsonContentType)
+		writeResponseBody(w, &verification)
+	}
+}
+
+// chainEvents sets the hash of each event of a batch whose ids are assigned, previousHash being
+// the hash of the last event of the same tenant. Stores call it in the insert transaction, with
+// the last event of the tenant locked so that concurrent batches cannot fork the chain
+func chainEvents(previousHash string, eventList []Event) {
+	for i := range eventList {
+		eventList[i].Hash = computeEventHash(previousHash, eventList[i])
+		previousHash = eventList[i].Hash
+	}
+}
+
+func computeEventHash(previousHash string, event Event) string {
+	hash := sha256.New()
+	hash.Write([]byte(previousHash))
+	hash.Write(encodeCanonicalEvent(event))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// encodeCanonicalEvent gives the same bytes whatever the way the store keeps the event: data is
+// re-encoded with sorted keys and the timestamp is truncated to the precision of the database
+func encodeCanonicalEvent(event Event) []byte {
+	var data interface{} = event.Data
+
+	decoder := json.NewDecoder(strings.NewReader(event.Data))
+	decoder.UseNumber()
+
+	var decodedData interface{}
+	if decoder.Decode(&decodedData) == nil {
+		data = decodedData
+	}
+
+	encoded, _ := json.Marshal(canonicalEvent{
+		Id:        event.Id,
+		Timestamp: event.Timestamp.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		Flags:     event.Flags,
+		Data:      data,
+		Tenant:    event.Tenant,
+	})
+
+	return encoded
+}
+
+// verifyChain walks the chain of the store from fromId, the stored hash of the last event before
+// it giving the hash the first checked event links to. It stops at the first event whose hash
+// does not match its content and the hash of the previous event
+func verifyChain(eventStore EventStore, fromId, toId int) ChainVerification {
+	verification := ChainVerification{FromId: fromId, ToId: toId, Valid: true}
+	previous := eventStore.GetLastEventBefore(fromId)
+	previousHash := previous.Hash
+
+	eventStore.StreamEventsAfterId(previous.Id, func(event Event) bool {
+		if toId > 0 && event.Id > toId {
+			return false
+		}
+
+		switch {
+		case isNeutralEvent(event):
+			verification.Neutralized++
+		case event.Hash != computeEventHash(previousHash, event):
+			verification.Valid = false
+			verification.BrokenAt = event.Id
+			return false
+		default:
+			verification.Verified++
+		}
+
+		previousHash = event.Hash
+		return true
+	})
+
+	return verification
+}
+
+func getIdRangeFromRequest(r *http.Request) (fromId, toId int, err error) {
+	parameters := r.URL.Query()
+
+	if value := parameters.Get(verifyFromIdParameter); value != "" {
+		if fromId, err = strconv.Atoi(value); err != nil || fromId < 0 {
+			return 0, 0, errInvalidParameter(verifyFromIdParameter)
+		}
+	}
+
+	if value := parameters.Get(verifyToIdParameter); value != "" {
+		if toId, err = strconv.Atoi(value); err != nil || toId < fromId {
+			return 0, 0, errInvalidParameter(verifyToIdParameter)
+		}
+	}
+
+	return
+}
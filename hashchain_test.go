@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHashChain(t *testing.T) {
+	clock = MockClock{}
+
+	t.Run("Registered events should each be chained to the previous event", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+
+		postEventsTo(t, api_url, []Event{validEvent1, validEvent2})
+		postEventsTo(t, api_url, []Event{validEvent5})
+
+		if len(stub.events) != 3 {
+			t.Fatalf("got %d stored events, want 3", len(stub.events))
+		}
+
+		previousHash := ""
+		for _, event := range stub.events {
+			assertResponseBody(t, event.Hash, computeEventHash(previousHash, event))
+			previousHash = event.Hash
+		}
+	})
+
+	t.Run("Hash should not depend on the way the store keeps the data and timestamp", func(t *testing.T) {
+		event := Event{Id: 1, Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC), Flags: []int{7}, Data: `{"score": 12.50, "map": "dust"}`}
+		storedEvent := Event{Id: 1, Timestamp: time.Date(2020, 1, 1, 1, 0, 0, 123456000, time.FixedZone("CET", 3600)), Flags: []int{7}, Data: `{"map":"dust","score":12.50}`}
+		alteredEvent := Event{Id: 1, Timestamp: event.Timestamp, Flags: []int{7}, Data: `{"map":"dust","score":13}`}
+
+		assertResponseBody(t, computeEventHash("", storedEvent), computeEventHash("", event))
+
+		if computeEventHash("", alteredEvent) == computeEventHash("", event) {
+			t.Errorf("altered data should change the hash")
+		}
+	})
+
+	t.Run("Verify request should report an intact chain", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		postEventsTo(t, api_url, []Event{validEvent1, validEvent2, validEvent5})
+
+		response := serveVerifyRequest(api_url + "verify")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{Valid: true, Verified: 3})
+	})
+
+	t.Run("Verify request should report the first altered event", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		postEventsTo(t, api_url, []Event{validEvent1, validEvent2, validEvent5})
+
+		stub.events[1].Data = `{"location": "US"}`
+
+		response := serveVerifyRequest(api_url + "verify")
+
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{Valid: false, Verified: 1, BrokenAt: 2})
+	})
+
+	t.Run("Verify request should report the link broken by an event rehashed after its alteration", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		postEventsTo(t, api_url, []Event{validEvent1, validEvent2, validEvent5})
+
+		stub.events[1].Data = `{"location": "US"}`
+		stub.events[1].Hash = computeEventHash("", stub.events[1])
+
+		response := serveVerifyRequest(api_url + "verify")
+
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{Valid: false, Verified: 1, BrokenAt: 2})
+
+		stub.events[1].Hash = computeEventHash(stub.events[0].Hash, stub.events[1])
+
+		response = serveVerifyRequest(api_url + "verify")
+
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{Valid: false, Verified: 2, BrokenAt: 3})
+	})
+
+	t.Run("Verify request should only check the events of the range", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		postEventsTo(t, api_url, []Event{validEvent1, validEvent2, validEvent5, validEvent4})
+
+		stub.events[0].Data = `{"location": "US"}`
+		stub.events[3].Data = `{"location": "US"}`
+
+		response := serveVerifyRequest(api_url + "verify?fromId=2&toId=3")
+
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{FromId: 2, ToId: 3, Valid: true, Verified: 2})
+	})
+
+	t.Run("Verify request should start streaming after the last event before the range", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		postEventsTo(t, api_url, []Event{validEvent1, validEvent2, validEvent5, validEvent4})
+
+		recording := &streamRecordingEventStore{StubEventStore: stub}
+		store = recording
+
+		response := serveVerifyRequest(api_url + "verify?fromId=3")
+
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{FromId: 3, Valid: true, Verified: 2})
+		if len(recording.streamedIds) == 0 || recording.streamedIds[0] != 3 {
+			t.Errorf("stream should start at event 3, got ids %v", recording.streamedIds)
+		}
+	})
+
+	t.Run("Neutralized events should keep the chain intact", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		postEventsTo(t, api_url, []Event{validEvent1, validEvent2, validEvent5})
+
+		server.ServeHTTP(httptest.NewRecorder(), newDeleteRequest(api_url+"2"))
+
+		response := serveVerifyRequest(api_url + "verify")
+
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{Valid: true, Verified: 2, Neutralized: 1})
+	})
+
+	t.Run("Verify request should check the hash of an event only given the neutral flag", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		postEventsTo(t, api_url, []Event{validEvent1, validEvent2, validEvent5})
+
+		stub.events[1].Flags = neutralFlagsValue
+
+		response := serveVerifyRequest(api_url + "verify")
+
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{Valid: false, Verified: 1, BrokenAt: 2})
+	})
+
+	t.Run("Events sent with the neutral flag should be rejected", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+
+		forgedEvent := Event{Timestamp: neutralTimestampValue, Flags: neutralFlagsValue, Data: neutralDataValue}
+		postEventsTo(t, api_url, []Event{validEvent1, forgedEvent})
+
+		if len(stub.events) != 1 {
+			t.Fatalf("got %d stored events, want 1", len(stub.events))
+		}
+
+		response := serveVerifyRequest(api_url + "verify")
+
+		assertChainVerification(t, getChainVerificationFromResponse(t, response.Body), ChainVerification{Valid: true, Verified: 1})
+	})
+
+	t.Run("Each tenant should have its own chain", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}, apiKeys: tenantAdminAPIKeys()}
+		store = stub
+		useAuthentication(t, "")
+
+		serveWithAPIKey(newPostRequestTo(api_url, []Event{validEvent1}), "racer-key")
+		serveWithAPIKey(newPostRequestTo(api_url, []Event{validEvent2}), "puzzle-key")
+		serveWithAPIKey(newPostRequestTo(api_url, []Event{validEvent5}), "racer-key")
+
+		for _, key := range []string{"racer-key", "puzzle-key"} {
+			response := serveWithAPIKey(newGetRequest(api_url+"verify"), key)
+
+			verification := getChainVerificationFromResponse(t, response.Body)
+			if !verification.Valid {
+				t.Errorf("chain of %s should be intact, got %+v", key, verification)
+			}
+		}
+	})
+
+	t.Run("Verify request should return status code 422 with an invalid range", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		for _, query := range []string{"?fromId=abc", "?fromId=-1", "?fromId=3&toId=2"} {
+			response := serveVerifyRequest(api_url + "verify" + query)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("Only admins should verify the chain", func(t *testing.T) {
+		store = &StubEventStore{apiKeys: roleAPIKeys()}
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newGetRequest(api_url+"verify"), "staff-key")
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+	})
+}
+
+// Test doubles
+// streamRecordingEventStore records the ids of the events it streams, ignoring tenants
+type streamRecordingEventStore struct {
+	*StubEventStore
+	streamedIds []int
+}
+
+func (s *streamRecordingEventStore) ForTenant(tenant string) EventStore {
+	return s
+}
+
+func (s *streamRecordingEventStore) StreamEventsAfterId(id int, yield func(Event) bool) {
+	s.StubEventStore.StreamEventsAfterId(id, func(event Event) bool {
+		s.streamedIds = append(s.streamedIds, event.Id)
+		return yield(event)
+	})
+}
+
+// Helpers
+func serveVerifyRequest(target string) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, newGetRequest(target))
+
+	return response
+}
+
+func assertChainVerification(t *testing.T, got, want ChainVerification) {
+	t.Helper()
+
+	if got != want {
+		t.Errorf("incorrect verification, got %+v, want %+v", got, want)
+	}
+}
+
+func getChainVerificationFromResponse(t *testing.T, body io.Reader) (verification ChainVerification) {
+	t.Helper()
+
+	if err := json.NewDecoder(body).Decode(&verification); err != nil {
+		t.Fatalf("unable to parse response from server %q into chain verification: %v", body, err)
+	}
+
+	return
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+var ingestionChunkSize = 1000
+
+type lineError struct {
+	Line   int      `json:"line"`
+	Errors []string `json:"errors"`
+}
+
+type ingestionSummary struct {
+	AffectedLines int         `json:"affectedlines"`
+	Errors        []lineError `json:"errors,omitempty"`
+}
+
+// eventBatcher validates events read one line at a time and registers them in chunks of
+// ingestionChunkSize, so that a large body never has to be held in memory
+type eventBatcher struct {
+	eventStore EventStore
+	collection string
+	client     string
+	tenant     string
+	chunk      []Event
+	chunkLines []int
+	summary    ingestionSummary
+	quotaErr   error
+}
+
+func newEventBatcher(eventStore EventStore, collection, client, tenant string) *eventBatcher {
+	return &eventBatcher{eventStore: eventStore, collection: collection, client: client, tenant: tenant, chunk: make([]Event, 0, ingestionChunkSize)}
+}
+
+func (b *eventBatcher) add(lineNumber int, event Event) {
+	if b.quotaErr != nil {
+		b.reject(lineNumber, b.quotaErr.Error())
+		return
+	}
+
+	violations := getInvalidityReasons(event)
+	if len(violations) == 0 {
+		violations = getSchemaViolations(event)
+	}
+
+	if len(violations) > 0 {
+		b.reject(lineNumber, violations...)
+		return
+	}
+
+	setValidTime(&event)
+	setServerFields(&event, b.tenant)
+	b.chunk = append(b.chunk, event)
+	b.chunkLines = append(b.chunkLines, lineNumber)
+
+	if len(b.chunk) == ingestionChunkSize {
+		b.flush()
+	}
+}
+
+func (b *eventBatcher) reject(lineNumber int, errors ...string) {
+	b.summary.Errors = append(b.summary.Errors, lineError{Line: lineNumber, Errors: errors})
+}
+
+// flush rejects each line of the chunk once the daily quota is exceeded, the following lines
+// being rejected too. The events the store fails to register are given back to the quota
+func (b *eventBatcher) flush() {
+	if len(b.chunk) > 0 && b.quotaErr == nil {
+		if b.quotaErr = eventQuotas.consume(b.client, len(b.chunk)); b.quotaErr != nil {
+			for _, lineNumber := range b.chunkLines {
+				b.reject(lineNumber, b.quotaErr.Error())
+			}
+			b.chunk, b.chunkLines = b.chunk[:0], b.chunkLines[:0]
+			return
+		}
+
+		affectedLines := b.eventStore.RegisterNewEvents(b.chunk, newOutboxRecord(b.collection))
+		eventQuotas.refund(b.client, len(b.chunk)-affectedLines)
+		if affectedLines > 0 {
+			signalOutbox()
+		}
+
+		b.summary.AffectedLines += affectedLines
+		b.chunk, b.chunkLines = make([]Event, 0, ingestionChunkSize), b.chunkLines[:0]
+	}
+}
+
+// writeSummary registers the remaining events and writes the summary of the whole ingestion.
+// It answers 413 when the body was cut at the maximum size and 429 when the daily quota was exceeded,
+// the events registered before that point being kept anyway
+func (b *eventBatcher) writeSummary(w http.ResponseWriter, readErr error) {
+	b.flush()
+
+	w.Header().Set("content-type", jsonContentType)
+
+	if quotaErr, ok := getQuotaExceededError(b.quotaErr); ok {
+		w.Header().Set(retryAfterHeader, formatRetryAfter(quotaErr.retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+	} else if errors.Is(readErr, errBodyTooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}
+
+	writeResponseBody(w, &b.summary)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	bearerAuthScheme = "Bearer"
+	tenantClaim      = "tenant"
+)
+
+var jwtValidMethods = []string{"RS256", "ES256", "HS256"}
+
+var (
+	jwtKeys     *jwtKeySet
+	jwtIssuer   string
+	jwtAudience string
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+type verificationKey struct {
+	alg string
+	key interface{}
+}
+
+// jwtKeySet holds the keys of a JWKS file by kid, a key without kid only being used
+// for tokens without kid
+type jwtKeySet struct {
+	keys map[string]verificationKey
+}
+
+func loadJWTKeySet(path string) (*jwtKeySet, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJWTKeySet(content)
+}
+
+func parseJWTKeySet(content []byte) (*jwtKeySet, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	keySet := &jwtKeySet{keys: map[string]verificationKey{}}
+	for _, jwk := range document.Keys {
+		key, err := jwk.verificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		keySet.keys[jwk.Kid] = key
+	}
+
+	return keySet, nil
+}
+
+func (jwk jsonWebKey) verificationKey() (verificationKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(jwk.N)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		e, err := decodeBase64URL(jwk.E)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return verificationKey{alg: "RS256", key: key}, nil
+
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		y, err := decodeBase64URL(jwk.Y)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return verificationKey{alg: "ES256", key: key}, nil
+
+	case "oct":
+		secret, err := decodeBase64URL(jwk.K)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		return verificationKey{alg: "HS256", key: secret}, nil
+	}
+
+	return verificationKey{}, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// keyFunc only returns a key whose algorithm is the one of the token,
+// so that a public key can never be used as an HMAC secret
+func (s *jwtKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q cannot be used with %s", kid, token.Method.Alg())
+	}
+
+	return key.key, nil
+}
+
+func authenticateBearerToken(tokenString string) (Principal, bool) {
+	if jwtKeys == nil {
+		return Principal{}, false
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtValidMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(clock.Now),
+	}
+	if jwtIssuer != "" {
+		options = append(options, jwt.WithIssuer(jwtIssuer))
+	}
+	if jwtAudience != "" {
+		options = append(options, jwt.WithAudience(jwtAudience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, jwtKeys.keyFunc, options...); err != nil {
+		return Principal{}, false
+	}
+
+	subject, _ := claims.GetSubject()
+	tenant, _ := claims[tenantClaim].(string)
+
+	return Principal{Subject: subject, Roles: getRolesFromClaims(claims), Tenant: tenant, Claims: claims}, true
+}
+
+func decodeBase64URL(value string) ([]byte, error) {
+	if value == "" {
+		return nil, errors.New("missing key parameter")
+	}
+	return base64.RawURLEncoding.DecodeString(value)
+}
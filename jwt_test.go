@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	testRSAKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	testECDSAKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testHMACSecret  = []byte("0123456789abcdef0123456789abcdef")
+)
+
+func TestJWTAuthentication(t *testing.T) {
+	clock = MockClock{}
+	validUntil := jwt.NewNumericDate(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	t.Run("Bearer tokens signed by a key of the set should authenticate requests", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}}
+		useAuthentication(t, "")
+		useJWTKeySet(t)
+
+		tokens := []string{
+			signToken(t, jwt.SigningMethodRS256, "rsa", testRSAKey, jwt.MapClaims{"sub": "game-backend", "exp": validUntil, "roles": []string{readerRole}}),
+			signToken(t, jwt.SigningMethodES256, "ec", testECDSAKey, jwt.MapClaims{"sub": "game-backend", "exp": validUntil, "roles": []string{readerRole}}),
+			signToken(t, jwt.SigningMethodHS256, "hmac", testHMACSecret, jwt.MapClaims{"sub": "game-backend", "exp": validUntil, "roles": []string{readerRole}}),
+		}
+
+		for _, token := range tokens {
+			request := newGetRequest(api_url + "1")
+			request.Header.Set(authorizationHeader, "Bearer "+token)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("Bearer tokens should return status code 401 when they cannot be trusted", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}}
+		useAuthentication(t, "")
+		useJWTKeySet(t)
+
+		publicKeyAsSecret := testRSAKey.PublicKey.N.Bytes()
+		otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+		tokens := map[string]string{
+			"expired":       signToken(t, jwt.SigningMethodRS256, "rsa", testRSAKey, jwt.MapClaims{"exp": jwt.NewNumericDate(time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC))}),
+			"without exp":   signToken(t, jwt.SigningMethodRS256, "rsa", testRSAKey, jwt.MapClaims{"sub": "game-backend"}),
+			"unknown kid":   signToken(t, jwt.SigningMethodRS256, "other", testRSAKey, jwt.MapClaims{"exp": validUntil}),
+			"wrong key":     signToken(t, jwt.SigningMethodRS256, "rsa", otherKey, jwt.MapClaims{"exp": validUntil}),
+			"alg confusion": signToken(t, jwt.SigningMethodHS256, "rsa", publicKeyAsSecret, jwt.MapClaims{"exp": validUntil}),
+			"malformed":     "not.a.token",
+		}
+
+		for name, token := range tokens {
+			request := newGetRequest(api_url + "1")
+			request.Header.Set(authorizationHeader, "Bearer "+token)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			if response.Code != http.StatusUnauthorized {
+				t.Errorf("%s token: got status %d, want %d", name, response.Code, http.StatusUnauthorized)
+			}
+		}
+	})
+
+	t.Run("Authentication should expose the token claims to handlers", func(t *testing.T) {
+		useAuthentication(t, "")
+		useJWTKeySet(t)
+
+		var got Principal
+		handler := authenticationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = getPrincipal(r)
+		}))
+
+		request := newGetRequest(api_url)
+		request.Header.Set(authorizationHeader, "Bearer "+signToken(t, jwt.SigningMethodES256, "ec", testECDSAKey, jwt.MapClaims{"sub": "player-42", "exp": validUntil, "game": "racer"}))
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		assertResponseBody(t, got.Subject, "player-42")
+		assertResponseBody(t, fmt.Sprint(got.Claims["game"]), "racer")
+	})
+
+	t.Run("Key set should reject unsupported keys", func(t *testing.T) {
+		for _, content := range []string{`{"keys": [{"kty": "OKP", "kid": "a"}]}`, `{"keys": [{"kty": "EC", "crv": "P-521", "x": "AA", "y": "AA"}]}`, `{"keys": [{"kty": "oct"}]}`, `keys`} {
+			if _, err := parseJWTKeySet([]byte(content)); err == nil {
+				t.Errorf("expected an error for key set %s", content)
+			}
+		}
+	})
+}
+
+// Helpers
+func useJWTKeySet(t *testing.T) {
+	t.Helper()
+
+	content := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "oct", "kid": "hmac", "k": %q}
+	]}`,
+		encodeBase64URL(testRSAKey.PublicKey.N.Bytes()), encodeBase64URL(big.NewInt(int64(testRSAKey.PublicKey.E)).Bytes()),
+		encodeBase64URL(testECDSAKey.PublicKey.X.Bytes()), encodeBase64URL(testECDSAKey.PublicKey.Y.Bytes()),
+		encodeBase64URL(testHMACSecret))
+
+	keySet, err := parseJWTKeySet([]byte(content))
+	assertNoError(t, err)
+
+	previousKeys := jwtKeys
+	jwtKeys = keySet
+	t.Cleanup(func() { jwtKeys = previousKeys })
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	assertNoError(t, err)
+
+	return signed
+}
+
+func encodeBase64URL(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
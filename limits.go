@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+)
+
+var (
+	maxBodySize    int64 = 10 << 20
+	maxBatchLength       = 10000
+	maxDataSize          = 64 << 10
+	strictJSON           = false
+)
+
+var (
+	errBatchTooLong = errors.New("too many events in batch")
+	errTrailingData = errors.New("unexpected data after json value")
+)
+
+// bodyLimitMiddleware answers 413 to bodies larger than maxBodySize, or cuts them when their length
+// is unknown. NDJSON and CSV event ingestions are read in bounded chunks, each line being limited instead
+func bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maxBodySize <= 0 || isStreamedIngestion(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > maxBodySize {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = &limitedBody{ReadCloser: r.Body, remaining: maxBodySize}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isStreamedIngestion(r *http.Request) bool {
+	if r.Method != http.MethodPost || getRouteTemplate(r) != api_route {
+		return false
+	}
+
+	return hasContentType(r, ndjsonContentType) || hasContentType(r, csvContentType)
+}
+
+// recordLimitedBody limits each line or record of a streamed ingestion to maxBodySize, the
+// handler calling reset once a record is read
+type recordLimitedBody struct {
+	limitedBody
+	limit int64
+}
+
+func newRecordLimitedBody(body io.ReadCloser) *recordLimitedBody {
+	limit := maxBodySize
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+
+	return &recordLimitedBody{limitedBody: limitedBody{ReadCloser: body, remaining: limit}, limit: limit}
+}
+
+func (b *recordLimitedBody) reset() {
+	b.remaining = b.limit
+}
+
+// decodeJson rejects unknown fields and anything after the value in strict mode
+func decodeJson(data []byte, content interface{}) error {
+	if !strictJSON {
+		return json.Unmarshal(data, content)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(content); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+
+	return nil
+}
+
+func getDataSizeViolation(event Event) (reasons []string) {
+	if maxDataSize > 0 && len(event.Data) > maxDataSize {
+		reasons = append(reasons, fmt.Sprintf("data must not exceed %d bytes", maxDataSize))
+	}
+
+	return
+}
+
+func isBatchTooLong(eventList []Event) bool {
+	return maxBatchLength > 0 && len(eventList) > maxBatchLength
+}
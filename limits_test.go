@@ -0,0 +1,209 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRequestBodyLimits(t *testing.T) {
+	t.Run("Post request should return status code 413 when the body exceeds the maximum size", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		useMaxBodySize(t, 64)
+
+		request := newPostRequestTo(api_url, []Event{validEvent1, validEvent2})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+
+		request = newPostRequestTo(api_url, []Event{validEvent1, validEvent2})
+		request.ContentLength = -1
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("NDJSON ingestion should limit each line rather than the whole body", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		line := toJsonLine(validEvent1) + "\n"
+		useMaxBodySize(t, int64(len(line)))
+
+		request := newNDJSONPostRequest(api_url, line+line)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertIngestionSummary(t, getIngestionSummaryFromResponse(t, response), ingestionSummary{AffectedLines: 2})
+
+		request = newNDJSONPostRequest(api_url, line+strings.Repeat(" ", 2*len(line))+line)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("CSV ingestion should limit each record", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		useMaxBodySize(t, 64)
+
+		request := newCSVPostRequest(api_url, "id,timestamp,flags,data\n1,,2,\"{\"\"a\"\": \"\""+strings.Repeat("x", 128)+"\"\"}\"\n")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("NDJSON and CSV content types should not lift the limit outside event ingestion", func(t *testing.T) {
+		store = &StubEventStore{}
+		useMaxBodySize(t, 64)
+
+		for _, contentType := range []string{ndjsonContentType, csvContentType} {
+			request := newRequestWithBody(http.MethodPost, flags_url, Flag{Id: 1, Name: "kill", Description: strings.Repeat("x", 128)})
+			request.Header.Set("content-type", contentType)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+		}
+	})
+
+	t.Run("WebSocket connection should be closed by a message over the maximum size", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		useMaxBodySize(t, 64)
+		conn := dialWebsocket(t, api_url+"ws")
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsPublish, Id: strings.Repeat("x", 128)})
+
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Errorf("expected the connection to be closed as message too big, got %v", err)
+		}
+	})
+
+	t.Run("Post request should return status code 413 when the batch exceeds the maximum length", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+		useMaxBatchLength(t, 1)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostRequestTo(api_url, []Event{validEvent1, validEvent2}))
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+		assertCalledFunction(t, spy.calledFunction, "")
+	})
+
+	t.Run("WebSocket publish should be answered with an error when the batch exceeds the maximum length", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		useMaxBatchLength(t, 1)
+		conn := dialWebsocket(t, api_url+"ws")
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsPublish, Id: "p1", Events: []Event{validEvent1, validEvent2}})
+		message := readWebsocketMessage(t, conn)
+
+		assertResponseBody(t, message.Type, wsError)
+		assertResponseBody(t, message.Error, errBatchTooLong.Error())
+	})
+
+	t.Run("Events whose Data exceeds the maximum size should be rejected", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		useMaxDataSize(t, 10)
+
+		request := newNDJSONPostRequest(api_url, toJsonLine(validEvent1)+"\n"+toJsonLine(validEvent2))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		want := ingestionSummary{AffectedLines: 1, Errors: []lineError{{Line: 1, Errors: []string{"data must not exceed 10 bytes"}}}}
+		assertIngestionSummary(t, getIngestionSummaryFromResponse(t, response), want)
+	})
+}
+
+func TestStrictJSONDecoding(t *testing.T) {
+	t.Run("Post request should ignore unknown fields and decode errors when not strict", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+
+		request := newRequestWithStringBody(api_url, `[{"id": 1, "flags": [2], "data": "{}", "score": 3}]`)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "{\"affectedlines\":1}")
+	})
+
+	t.Run("Post request should return status code 422 for unknown fields or trailing data in strict mode", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+		useStrictJSON(t)
+
+		bodies := []string{
+			`[{"id": 1, "flags": [2], "data": "{}", "score": 3}]`,
+			`[{"id": 1, "flags": [2], "data": "{}"}] []`,
+			`[{"id": 1, "flags": [2], "data": "{}"}`,
+		}
+
+		for _, body := range bodies {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newRequestWithStringBody(api_url, body))
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+		assertCalledFunction(t, spy.calledFunction, "")
+	})
+
+	t.Run("NDJSON ingestion should reject lines with unknown fields in strict mode", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		useStrictJSON(t)
+
+		request := newNDJSONPostRequest(api_url, toJsonLine(validEvent1)+"\n"+`{"id": 2, "flags": [2], "data": "{}", "score": 3}`)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		summary := getIngestionSummaryFromResponse(t, response)
+		if summary.AffectedLines != 1 || len(summary.Errors) != 1 || !strings.Contains(summary.Errors[0].Errors[0], "unknown field") {
+			t.Errorf("incorrect summary %+v", summary)
+		}
+	})
+}
+
+// Helpers
+func useMaxBodySize(t *testing.T, size int64) {
+	t.Helper()
+
+	previousSize := maxBodySize
+	maxBodySize = size
+	t.Cleanup(func() { maxBodySize = previousSize })
+}
+
+func useMaxBatchLength(t *testing.T, length int) {
+	t.Helper()
+
+	previousLength := maxBatchLength
+	maxBatchLength = length
+	t.Cleanup(func() { maxBatchLength = previousLength })
+}
+
+func useMaxDataSize(t *testing.T, size int) {
+	t.Helper()
+
+	previousSize := maxDataSize
+	maxDataSize = size
+	t.Cleanup(func() { maxDataSize = previousSize })
+}
+
+func useStrictJSON(t *testing.T) {
+	t.Helper()
+
+	strictJSON = true
+	t.Cleanup(func() { strictJSON = false })
+}
+
+func newRequestWithStringBody(target, body string) *http.Request {
+	request, _ := http.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	request.Header.Set("content-type", jsonContentType)
+	return request
+}
@@ -4,20 +4,62 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
-var store interface {
+type EventStore interface {
+	ForTenant(tenant string) EventStore
+
 	GetEventById(id int) Event
+	GetLastEventBefore(id int) Event
 	GetAllEvents() []Event
 	GetEventsByFlag(flag int) []Event
-	RegisterNewEvents(eventList []Event) int
+	GetFlagStats(from, to time.Time, excludedFlags []int) []FlagStats
+	StreamAllEvents(yield func(Event) bool)
+	StreamEventsByFlag(flag int, yield func(Event) bool)
+	StreamEventsAfterId(id int, yield func(Event) bool)
+	StreamEventsBetween(from, to time.Time, yield func(Event) bool)
+	RegisterNewEvents(eventList []Event, outbox OutboxRecord) int
 	DeleteById(id int) int
 	DeleteByFlag(flag int) int
+	GetChangesSince(sequence int64, limit int) (changeList []Change, lastSequence int64)
+	GetPendingOutboxRecords(limit int) []OutboxRecord
+	MarkOutboxRecordDispatched(id int) int
+
+	GetFlagById(id int) Flag
+	GetFlagByName(name string) Flag
+	GetAllFlags() []Flag
+	RegisterFlag(flag Flag) int
+	UpdateFlag(flag Flag) int
+	DeleteFlag(id int) int
+
+	GetAllCollections() []Collection
+	RegisterCollection(collection Collection) int
+	DeleteCollection(name string) int
+
+	GetAllWebhooks() []Webhook
+	GetWebhookById(id int) Webhook
+	RegisterWebhook(webhook Webhook) int
+	DeleteWebhook(id int) int
+	RegisterDelivery(delivery Delivery) int
+	GetPendingDeliveries(now time.Time, limit int) []Delivery
+	GetDeliveriesByWebhook(webhookId int) []Delivery
+	UpdateDelivery(delivery Delivery) int
+
+	GetAllAPIKeys() []APIKey
+	GetAPIKeyByHash(hash string) APIKey
+	RegisterAPIKey(apiKey APIKey) int
+	RevokeAPIKey(id int, revokedAt time.Time) int
+
+	RegisterAuditedAction(entry AuditEntry, action func() int) (affectedLines int, ok bool)
+	GetAuditEntries(from, to time.Time) []AuditEntry
 }
 
+var store EventStore
+
 var clock interface {
 	Now() time.Time
 }
@@ -36,9 +78,105 @@ func main() {
 	}
 
 	api_port := os.Getenv("API_PORT")
+	rejectUnregisteredFlags, _ = strconv.ParseBool(os.Getenv("REJECT_UNREGISTERED_FLAGS"))
+	if requireAuthentication, err = parseRequireAuthentication(os.Getenv("REQUIRE_AUTHENTICATION")); err != nil {
+		log.Fatal("Invalid REQUIRE_AUTHENTICATION: ", err)
+	}
+	if !requireAuthentication {
+		log.Println("Authentication is disabled: every request, administration included, is allowed")
+	}
+	bootstrapAPIKey = os.Getenv("BOOTSTRAP_API_KEY")
+	jwtIssuer = os.Getenv("JWT_ISSUER")
+	jwtAudience = os.Getenv("JWT_AUDIENCE")
+
+	if path := os.Getenv("JWKS_FILE"); path != "" {
+		if jwtKeys, err = loadJWTKeySet(path); err != nil {
+			log.Fatal("Error loading JWKS file: ", err)
+		}
+	}
+
+	if chunkSize, err := strconv.Atoi(os.Getenv("INGESTION_CHUNK_SIZE")); err == nil && chunkSize > 0 {
+		ingestionChunkSize = chunkSize
+	}
+
+	if maxSize, err := strconv.ParseInt(os.Getenv("MAX_DECOMPRESSED_SIZE"), 10, 64); err == nil && maxSize > 0 {
+		maxDecompressedSize = maxSize
+	}
+
+	if size, err := strconv.ParseInt(os.Getenv("MAX_BODY_SIZE"), 10, 64); err == nil {
+		maxBodySize = size
+	}
+
+	if length, err := strconv.Atoi(os.Getenv("MAX_BATCH_LENGTH")); err == nil {
+		maxBatchLength = length
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("MAX_DATA_SIZE")); err == nil {
+		maxDataSize = size
+	}
+
+	strictJSON, _ = strconv.ParseBool(os.Getenv("STRICT_JSON"))
+
+	corsAllowedOrigins = parseHeaderList(os.Getenv("CORS_ALLOWED_ORIGINS"))
 
-	store = PostGreStore{}
+	if methods := parseHeaderList(os.Getenv("CORS_ALLOWED_METHODS")); len(methods) > 0 {
+		corsAllowedMethods = methods
+	}
+
+	if headers := parseHeaderList(os.Getenv("CORS_ALLOWED_HEADERS")); len(headers) > 0 {
+		corsAllowedHeaders = headers
+	}
+
+	if maxAge, err := strconv.Atoi(os.Getenv("CORS_MAX_AGE")); err == nil {
+		corsMaxAge = maxAge
+	}
+
+	requestRateLimit, _ = strconv.ParseFloat(os.Getenv("RATE_LIMIT_PER_SECOND"), 64)
+	requestBurstLimit, _ = strconv.Atoi(os.Getenv("RATE_LIMIT_BURST"))
+	ipRateLimit, _ = strconv.ParseFloat(os.Getenv("IP_RATE_LIMIT_PER_SECOND"), 64)
+	ipBurstLimit, _ = strconv.Atoi(os.Getenv("IP_RATE_LIMIT_BURST"))
+	dailyEventQuota, _ = strconv.Atoi(os.Getenv("DAILY_EVENT_QUOTA"))
+
+	store = PostGreStore{table: defaultTable, limit: defaultLimit}
 	clock = RealClock{}
 
-	log.Fatal(http.ListenAndServe(api_port, newServer()))
+	loadCollections()
+	go runOutboxRelay()
+	go runWebhookDispatcher()
+
+	certFile, keyFile, clientCAFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"), os.Getenv("TLS_CLIENT_CA_FILE")
+	clientRoles := parseHeaderList(os.Getenv("TLS_CLIENT_ROLES"))
+
+	requireClientCert := false
+	if value := os.Getenv("TLS_REQUIRE_CLIENT_CERT"); value != "" {
+		if requireClientCert, err = strconv.ParseBool(value); err != nil {
+			log.Fatal("Invalid TLS_REQUIRE_CLIENT_CERT: ", err)
+		}
+	}
+
+	if err := checkTLSSettings(certFile, keyFile, clientCAFile, requireClientCert, clientRoles); err != nil {
+		log.Fatal("Invalid TLS settings: ", err)
+	}
+
+	if certFile == "" {
+		log.Fatal(http.ListenAndServe(api_port, newServer()))
+	}
+
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		log.Fatal("Error loading TLS certificate: ", err)
+	}
+	go reloader.watch()
+
+	tlsConfig, err := newTLSConfig(reloader, clientCAFile, requireClientCert)
+	if err != nil {
+		log.Fatal("Error loading TLS client CA: ", err)
+	}
+
+	if len(clientRoles) > 0 {
+		tlsClientRoles = clientRoles
+	}
+
+	server := &http.Server{Addr: api_port, Handler: newServer(), TLSConfig: tlsConfig}
+	log.Fatal(server.ListenAndServeTLS("", ""))
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+func postNDJSONHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	batcher := newEventBatcher(eventStore, mux.Vars(r)["controller"], getClientId(r), getTenant(r))
+	body := newRecordLimitedBody(r.Body)
+	reader := bufio.NewReader(body)
+	var readErr error
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		body.reset()
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			event := Event{}
+
+			if decodeErr := decodeJson(line, &event); decodeErr != nil {
+				batcher.reject(lineNumber, fmt.Sprintf("invalid json: %v", decodeErr))
+			} else {
+				batcher.add(lineNumber, event)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			readErr = err
+			batcher.reject(lineNumber, fmt.Sprintf("unable to read body: %v", err))
+			break
+		}
+	}
+
+	batcher.writeSummary(w, readErr)
+}
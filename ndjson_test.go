@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPostNDJSONRequest(t *testing.T) {
+	t.Run("Post request should register events line by line in bounded chunks", func(t *testing.T) {
+		useIngestionChunkSize(t, 2)
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+		clock = MockClock{}
+
+		body := strings.Join([]string{
+			toJsonLine(validEvent1),
+			toJsonLine(validEvent2),
+			"",
+			toJsonLine(validEvent3),
+			toJsonLine(validEvent4),
+			toJsonLine(validEvent5),
+		}, "\n")
+
+		request := newNDJSONPostRequest(api_url, body)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		event3 := validEvent3
+		event3.Timestamp = clock.Now()
+		wantBatches := [][]Event{{validEvent1, validEvent2}, {event3, validEvent4}, {validEvent5}}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+		assertIngestionSummary(t, getIngestionSummaryFromResponse(t, response), ingestionSummary{AffectedLines: 5})
+		assertBatches(t, spy.registeredBatches, wantBatches)
+	})
+
+	t.Run("Post request should report errors with their line number", func(t *testing.T) {
+		useIngestionChunkSize(t, 1000)
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+
+		body := strings.Join([]string{
+			toJsonLine(validEvent1),
+			`{"id": 2, "flags": [`,
+			toJsonLine(invalidEvent2),
+			toJsonLine(validEvent2),
+		}, "\n") + "\n"
+
+		request := newNDJSONPostRequest(api_url, body)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := getIngestionSummaryFromResponse(t, response)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertBatches(t, spy.registeredBatches, [][]Event{{validEvent1, validEvent2}})
+
+		if got.AffectedLines != 2 || len(got.Errors) != 2 || got.Errors[0].Line != 2 || got.Errors[1].Line != 3 {
+			t.Fatalf("incorrect summary: got %+v", got)
+		}
+		if !reflect.DeepEqual(got.Errors[1].Errors, []string{"flags must contain at least one value"}) {
+			t.Errorf("incorrect errors for line 3: got %v", got.Errors[1].Errors)
+		}
+	})
+
+	t.Run("Post request should report schema violations", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}, flags: []Flag{timerFlag}}
+
+		request := newNDJSONPostRequest(api_url, toJsonLine(invalidTimerEvent))
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := ingestionSummary{Errors: []lineError{{Line: 1, Errors: []string{"flag 4: /timer_niveau4: expected integer, but got string"}}}}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertIngestionSummary(t, getIngestionSummaryFromResponse(t, response), want)
+	})
+}
+
+// Helpers
+func assertBatches(t *testing.T, got, want [][]Event) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("registered batches are different:\ngot %v\nwant %v", got, want)
+	}
+}
+
+func assertIngestionSummary(t *testing.T, got, want ingestionSummary) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect ingestion summary:\ngot %+v\nwant %+v", got, want)
+	}
+}
+
+func getIngestionSummaryFromResponse(t *testing.T, response *httptest.ResponseRecorder) (summary ingestionSummary) {
+	t.Helper()
+
+	err := json.NewDecoder(response.Body).Decode(&summary)
+
+	if err != nil {
+		t.Fatalf("unable to parse response from server %q into an ingestion summary: %v", response.Body, err)
+	}
+
+	return
+}
+
+func newNDJSONPostRequest(target, body string) *http.Request {
+	request, _ := http.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	request.Header.Set("content-type", ndjsonContentType)
+	return request
+}
+
+func toJsonLine(event Event) string {
+	line, _ := json.Marshal(event)
+	return string(line)
+}
+
+func useIngestionChunkSize(t *testing.T, size int) {
+	t.Helper()
+
+	previousSize := ingestionChunkSize
+	ingestionChunkSize = size
+	t.Cleanup(func() { ingestionChunkSize = previousSize })
+}
@@ -0,0 +1,66 @@
+package main
+
+import "time"
+
+// OutboxRecord is written by the store in the same transaction as the events it carries,
+// the relay then publishes it, so that registered events are published at least once.
+// Events and CreatedAt are set by the store on insert, the events being the rows as stored
+// with their ids and hashes
+type OutboxRecord struct {
+	Id         int       `json:"id"`
+	Collection string    `json:"collection"`
+	Events     []Event   `json:"events"`
+	CreatedAt  time.Time `json:"createdat"`
+}
+
+var (
+	outboxRelayInterval = time.Second
+	outboxBatchSize     = 100
+)
+
+var outboxSignal = make(chan struct{}, 1)
+
+func newOutboxRecord(collection string) OutboxRecord {
+	return OutboxRecord{Collection: collection}
+}
+
+// signalOutbox wakes the relay up without waiting for the next tick
+func signalOutbox() {
+	select {
+	case outboxSignal <- struct{}{}:
+	default:
+	}
+}
+
+func runOutboxRelay() {
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-outboxSignal:
+		}
+
+		relayOutbox()
+	}
+}
+
+// relayOutbox publishes pending records of every collection, a record being marked only once
+// published: a crash in between leads to a second publication rather than a lost one
+func relayOutbox() {
+	forEachEventStore(func(eventStore EventStore) {
+		for {
+			records := eventStore.GetPendingOutboxRecords(outboxBatchSize)
+
+			for _, record := range records {
+				publishCreatedEvents(record.Collection, record.Events)
+				eventStore.MarkOutboxRecordDispatched(record.Id)
+			}
+
+			if len(records) < outboxBatchSize {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	t.Run("Post request should write the stored events to an outbox record and publish nothing before the relay runs", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}, events: []Event{validEvent1}}
+		store = stub
+		subscription := broker.subscribe(defaultController, "", nil, nil)
+		defer broker.unsubscribe(subscription)
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostRequestTo(api_url, withoutIds(validEvent2, validEvent4)))
+
+		records := stub.GetPendingOutboxRecords(outboxBatchSize)
+		if len(records) != 1 {
+			t.Fatalf("expected one pending outbox record, got %v", len(records))
+		}
+		assertResponseBody(t, records[0].Collection, defaultController)
+		assertEventList(t, records[0].Events, stub.events[1:])
+		if records[0].Events[0].Id != 2 || records[0].Events[1].Hash == "" {
+			t.Errorf("outbox record should carry the ids and hashes assigned by the store, got %+v", records[0].Events)
+		}
+
+		if len(subscription.events) != 0 {
+			t.Errorf("expected no published event, got %v", len(subscription.events))
+		}
+	})
+
+	t.Run("Relay should publish pending records once and mark them dispatched", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		subscription := broker.subscribe(defaultController, "", nil, nil)
+		defer broker.unsubscribe(subscription)
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostRequestTo(api_url, []Event{validEvent1, validEvent2}))
+
+		relayOutbox()
+		relayOutbox()
+
+		if len(subscription.events) != 2 {
+			t.Errorf("expected 2 published events, got %v", len(subscription.events))
+		}
+		if records := stub.GetPendingOutboxRecords(outboxBatchSize); len(records) != 0 {
+			t.Errorf("expected no pending outbox record, got %v", len(records))
+		}
+	})
+
+	t.Run("Relay should publish the events as stored to subscribers and webhooks", func(t *testing.T) {
+		clock = MockClock{}
+		stub := &StubEventStore{spy: &Spy{}, webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: "https://a.local", Secret: "s3cr3t"}}}
+		store = stub
+		subscription := broker.subscribe(defaultController, "", nil, nil)
+		defer broker.unsubscribe(subscription)
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostRequestTo(api_url, withoutIds(validEvent1)))
+
+		relayOutbox()
+
+		assertEvent(t, <-subscription.events, stub.events[0])
+
+		payload := notification{}
+		_ = json.Unmarshal([]byte(stub.deliveries[0].Payload), &payload)
+		assertEventList(t, payload.Events, stub.events)
+	})
+
+	t.Run("Relay should dispatch the records of every collection", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		telemetry := &StubEventStore{spy: &Spy{}}
+		useCollectionStores(t, map[string]EventStore{"telemetry": telemetry})
+		subscription := broker.subscribe("telemetry", "", nil, nil)
+		defer broker.unsubscribe(subscription)
+
+		server.ServeHTTP(httptest.NewRecorder(), newPostRequestTo("/api/telemetry/", []Event{validEvent1}))
+
+		relayOutbox()
+
+		if len(subscription.events) != 1 {
+			t.Errorf("expected 1 published event, got %v", len(subscription.events))
+		}
+		if records := telemetry.GetPendingOutboxRecords(outboxBatchSize); len(records) != 0 {
+			t.Errorf("expected no pending outbox record, got %v", len(records))
+		}
+	})
+}
@@ -1,11 +1,28 @@
 package main
 
-type PostGreStore struct{}
+import "time"
+
+type PostGreStore struct {
+	table  string
+	limit  int
+	tenant string
+}
+
+// ForTenant returns the store restricted to the rows of tenant, which every event query filters on
+func (p PostGreStore) ForTenant(tenant string) EventStore {
+	p.tenant = tenant
+	return p
+}
 
 func (p PostGreStore) GetEventById(id int) (event Event) {
 	return
 }
 
+// GetLastEventBefore orders the events below id by id DESC with a LIMIT of 1
+func (p PostGreStore) GetLastEventBefore(id int) (event Event) {
+	return
+}
+
 func (p PostGreStore) GetAllEvents() (eventList []Event) {
 	return
 }
@@ -14,7 +31,27 @@ func (p PostGreStore) GetEventsByFlag(flag int) (eventList []Event) {
 	return
 }
 
-func (p PostGreStore) RegisterNewEvents(eventList []Event) (insertedLines int) {
+// GetFlagStats counts in the database with COUNT, MIN and MAX over unnest(flags) GROUP BY flag,
+// leaving out the neutralized events and those whose flags overlap excludedFlags
+func (p PostGreStore) GetFlagStats(from, to time.Time, excludedFlags []int) (flagStats []FlagStats) {
+	return
+}
+
+func (p PostGreStore) StreamAllEvents(yield func(Event) bool) {
+}
+
+func (p PostGreStore) StreamEventsByFlag(flag int, yield func(Event) bool) {
+}
+
+func (p PostGreStore) StreamEventsAfterId(id int, yield func(Event) bool) {
+}
+
+func (p PostGreStore) StreamEventsBetween(from, to time.Time, yield func(Event) bool) {
+}
+
+// RegisterNewEvents chains the events with chainEvents once inserted, the last event of the tenant
+// being locked for the transaction, and writes the inserted rows into the outbox record
+func (p PostGreStore) RegisterNewEvents(eventList []Event, outbox OutboxRecord) (insertedLines int) {
 	return
 }
 
@@ -25,3 +62,115 @@ func (p PostGreStore) DeleteById(id int) (deletedLines int) {
 func (p PostGreStore) DeleteByFlag(flag int) (deletedLines int) {
 	return
 }
+
+// GetChangesSince keeps the rows whose transaction id, recorded with pg_current_xact_id(), is
+// below pg_snapshot_xmin(pg_current_snapshot()): later sequences wait for the transactions
+// still running to commit or roll back, ordered by sequence with a LIMIT of limit rows
+func (p PostGreStore) GetChangesSince(sequence int64, limit int) (changeList []Change, lastSequence int64) {
+	return
+}
+
+func (p PostGreStore) GetPendingOutboxRecords(limit int) (recordList []OutboxRecord) {
+	return
+}
+
+func (p PostGreStore) MarkOutboxRecordDispatched(id int) (updatedLines int) {
+	return
+}
+
+func (p PostGreStore) GetFlagById(id int) (flag Flag) {
+	return
+}
+
+func (p PostGreStore) GetFlagByName(name string) (flag Flag) {
+	return
+}
+
+func (p PostGreStore) GetAllFlags() (flagList []Flag) {
+	return
+}
+
+func (p PostGreStore) RegisterFlag(flag Flag) (insertedLines int) {
+	return
+}
+
+func (p PostGreStore) UpdateFlag(flag Flag) (updatedLines int) {
+	return
+}
+
+func (p PostGreStore) DeleteFlag(id int) (deletedLines int) {
+	return
+}
+
+func (p PostGreStore) GetAllCollections() (collectionList []Collection) {
+	return
+}
+
+func (p PostGreStore) RegisterCollection(collection Collection) (insertedLines int) {
+	return
+}
+
+func (p PostGreStore) DeleteCollection(name string) (deletedLines int) {
+	return
+}
+
+func (p PostGreStore) GetAllWebhooks() (webhookList []Webhook) {
+	return
+}
+
+func (p PostGreStore) GetWebhookById(id int) (webhook Webhook) {
+	return
+}
+
+func (p PostGreStore) RegisterWebhook(webhook Webhook) (id int) {
+	return
+}
+
+func (p PostGreStore) DeleteWebhook(id int) (deletedLines int) {
+	return
+}
+
+func (p PostGreStore) RegisterDelivery(delivery Delivery) (id int) {
+	return
+}
+
+// GetPendingDeliveries orders the pending deliveries by id and leaves out those of a webhook
+// following one whose next attempt is after now, with a LIMIT of limit rows
+func (p PostGreStore) GetPendingDeliveries(now time.Time, limit int) (deliveryList []Delivery) {
+	return
+}
+
+func (p PostGreStore) GetDeliveriesByWebhook(webhookId int) (deliveryList []Delivery) {
+	return
+}
+
+func (p PostGreStore) UpdateDelivery(delivery Delivery) (updatedLines int) {
+	return
+}
+
+func (p PostGreStore) GetAllAPIKeys() (apiKeyList []APIKey) {
+	return
+}
+
+func (p PostGreStore) GetAPIKeyByHash(hash string) (apiKey APIKey) {
+	return
+}
+
+func (p PostGreStore) RegisterAPIKey(apiKey APIKey) (id int) {
+	return
+}
+
+func (p PostGreStore) RevokeAPIKey(id int, revokedAt time.Time) (updatedLines int) {
+	return
+}
+
+// RegisterAuditedAction runs action in a transaction opened on the connection it pins, then inserts
+// entry with the affected lines before committing. A failed insert rolls the action back. The audit
+// table grants no UPDATE nor DELETE to the API role
+func (p PostGreStore) RegisterAuditedAction(entry AuditEntry, action func() int) (affectedLines int, ok bool) {
+	return
+}
+
+func (p PostGreStore) GetAuditEntries(from, to time.Time) (entryList []AuditEntry) {
+	return
+}
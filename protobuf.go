@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const protobufContentType = "application/x-protobuf"
+
+// Field numbers of the messages published in event.proto
+const (
+	eventListEventsField = 1
+
+	eventIdField        = 1
+	eventTimestampField = 2
+	eventFlagsField     = 3
+	eventDataField      = 4
+	eventTenantField    = 5
+	eventHashField      = 6
+
+	timestampSecondsField = 1
+	timestampNanosField   = 2
+)
+
+var errInvalidProtobuf = errors.New("invalid protobuf message")
+
+type protobufCodec struct{}
+
+func (c protobufCodec) contentType() string {
+	return protobufContentType
+}
+
+func (c protobufCodec) encodeEvent(event Event) ([]byte, error) {
+	return appendProtobufEvent(nil, event), nil
+}
+
+func (c protobufCodec) encodeEventList(eventList []Event) (data []byte, err error) {
+	for _, event := range eventList {
+		data = protowire.AppendTag(data, eventListEventsField, protowire.BytesType)
+		data = protowire.AppendBytes(data, appendProtobufEvent(nil, event))
+	}
+	return
+}
+
+func (c protobufCodec) decodeEventList(data []byte) (eventList []Event, err error) {
+	eventList = []Event{}
+
+	err = consumeProtobufFields(data, func(number protowire.Number, fieldType protowire.Type, value []byte) (int, error) {
+		if number != eventListEventsField || fieldType != protowire.BytesType {
+			return skipProtobufField(number, fieldType, value)
+		}
+
+		message, n := protowire.ConsumeBytes(value)
+		if n < 0 {
+			return n, errInvalidProtobuf
+		}
+
+		event, err := decodeProtobufEvent(message)
+		eventList = append(eventList, event)
+		return n, err
+	})
+
+	return
+}
+
+func appendProtobufEvent(data []byte, event Event) []byte {
+	if event.Id != 0 {
+		data = protowire.AppendTag(data, eventIdField, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(event.Id))
+	}
+
+	if !event.Timestamp.IsZero() {
+		var timestamp []byte
+		if seconds := event.Timestamp.Unix(); seconds != 0 {
+			timestamp = protowire.AppendTag(timestamp, timestampSecondsField, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(seconds))
+		}
+		if nanos := event.Timestamp.Nanosecond(); nanos != 0 {
+			timestamp = protowire.AppendTag(timestamp, timestampNanosField, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(nanos))
+		}
+
+		data = protowire.AppendTag(data, eventTimestampField, protowire.BytesType)
+		data = protowire.AppendBytes(data, timestamp)
+	}
+
+	if len(event.Flags) > 0 {
+		var flags []byte
+		for _, flag := range event.Flags {
+			flags = protowire.AppendVarint(flags, uint64(flag))
+		}
+
+		data = protowire.AppendTag(data, eventFlagsField, protowire.BytesType)
+		data = protowire.AppendBytes(data, flags)
+	}
+
+	if event.Data != "" {
+		data = protowire.AppendTag(data, eventDataField, protowire.BytesType)
+		data = protowire.AppendString(data, event.Data)
+	}
+
+	if event.Tenant != "" {
+		data = protowire.AppendTag(data, eventTenantField, protowire.BytesType)
+		data = protowire.AppendString(data, event.Tenant)
+	}
+
+	if event.Hash != "" {
+		data = protowire.AppendTag(data, eventHashField, protowire.BytesType)
+		data = protowire.AppendString(data, event.Hash)
+	}
+
+	return data
+}
+
+func decodeProtobufEvent(data []byte) (event Event, err error) {
+	err = consumeProtobufFields(data, func(number protowire.Number, fieldType protowire.Type, value []byte) (int, error) {
+		switch {
+		case number == eventIdField && fieldType == protowire.VarintType:
+			id, n := protowire.ConsumeVarint(value)
+			event.Id = int(int64(id))
+			return n, nil
+
+		case number == eventTimestampField && fieldType == protowire.BytesType:
+			message, n := protowire.ConsumeBytes(value)
+			if n < 0 {
+				return n, errInvalidProtobuf
+			}
+			timestamp, err := decodeProtobufTimestamp(message)
+			event.Timestamp = timestamp
+			return n, err
+
+		case number == eventFlagsField && fieldType == protowire.VarintType:
+			flag, n := protowire.ConsumeVarint(value)
+			event.Flags = append(event.Flags, int(int64(flag)))
+			return n, nil
+
+		case number == eventFlagsField && fieldType == protowire.BytesType:
+			packed, n := protowire.ConsumeBytes(value)
+			for len(packed) > 0 && n >= 0 {
+				flag, m := protowire.ConsumeVarint(packed)
+				if m < 0 {
+					return m, errInvalidProtobuf
+				}
+				event.Flags = append(event.Flags, int(int64(flag)))
+				packed = packed[m:]
+			}
+			return n, nil
+
+		case number == eventDataField && fieldType == protowire.BytesType:
+			eventData, n := protowire.ConsumeString(value)
+			event.Data = eventData
+			return n, nil
+
+		case number == eventTenantField && fieldType == protowire.BytesType:
+			tenant, n := protowire.ConsumeString(value)
+			event.Tenant = tenant
+			return n, nil
+
+		case number == eventHashField && fieldType == protowire.BytesType:
+			hash, n := protowire.ConsumeString(value)
+			event.Hash = hash
+			return n, nil
+		}
+
+		return skipProtobufField(number, fieldType, value)
+	})
+
+	return
+}
+
+func decodeProtobufTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos int64
+
+	err := consumeProtobufFields(data, func(number protowire.Number, fieldType protowire.Type, value []byte) (int, error) {
+		if fieldType != protowire.VarintType || (number != timestampSecondsField && number != timestampNanosField) {
+			return skipProtobufField(number, fieldType, value)
+		}
+
+		field, n := protowire.ConsumeVarint(value)
+		if number == timestampSecondsField {
+			seconds = int64(field)
+		} else {
+			nanos = int64(int32(field))
+		}
+		return n, nil
+	})
+
+	return time.Unix(seconds, nanos).UTC(), err
+}
+
+// consumeProtobufFields calls consumeValue for each field of the message, which must return
+// the length of the value it consumed
+func consumeProtobufFields(data []byte, consumeValue func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(data) > 0 {
+		number, fieldType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errInvalidProtobuf
+		}
+		data = data[n:]
+
+		m, err := consumeValue(number, fieldType, data)
+		if err != nil {
+			return err
+		}
+		if m < 0 {
+			return errInvalidProtobuf
+		}
+		data = data[m:]
+	}
+
+	return nil
+}
+
+func skipProtobufField(number protowire.Number, fieldType protowire.Type, value []byte) (int, error) {
+	n := protowire.ConsumeFieldValue(number, fieldType, value)
+	if n < 0 {
+		return n, errInvalidProtobuf
+	}
+	return n, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	retryAfterHeader   = "Retry-After"
+	maxIdleBucketCount = 10000
+)
+
+var (
+	requestRateLimit  float64
+	requestBurstLimit int
+	ipRateLimit       float64
+	ipBurstLimit      int
+	dailyEventQuota   int
+)
+
+var (
+	requestLimiter = newRateLimiter()
+	ipLimiter      = newRateLimiter()
+	eventQuotas    = newQuotaCounter()
+)
+
+type quotaExceededError struct {
+	retryAfter time.Duration
+}
+
+var errRateLimitExceeded = errors.New("rate limit exceeded")
+
+func (e *quotaExceededError) Error() string {
+	return fmt.Sprintf("daily event quota exceeded, retry after %v", e.retryAfter)
+}
+
+// ipRateLimitMiddleware runs before authentication, so that the key lookups and token checks
+// of a single address stay bounded whatever the credentials it sends
+func ipRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ipRateLimit > 0 {
+			if ok, retryAfter := ipLimiter.allow(getRemoteIp(r), clock.Now(), ipRateLimit, ipBurstLimit); !ok {
+				writeTooManyRequests(w, retryAfter)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitMiddleware runs after authentication, so that clients are told apart by API key
+// or token subject, anonymous ones by IP address
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestRateLimit > 0 {
+			if ok, retryAfter := requestLimiter.allow(getClientId(r), clock.Now(), requestRateLimit, requestBurstLimit); !ok {
+				writeTooManyRequests(w, retryAfter)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getClientId(r *http.Request) string {
+	if principal, ok := getPrincipal(r); ok {
+		if principal.APIKeyId != 0 {
+			return "apikey:" + strconv.Itoa(principal.APIKeyId)
+		}
+		return "subject:" + principal.Subject
+	}
+
+	return "ip:" + getRemoteIp(r)
+}
+
+func getRemoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set(retryAfterHeader, formatRetryAfter(retryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+func formatRetryAfter(retryAfter time.Duration) string {
+	return strconv.Itoa(getRetryAfterSeconds(retryAfter))
+}
+
+// getRetryAfterSeconds rounds up to whole seconds, never less than one
+func getRetryAfterSeconds(retryAfter time.Duration) int {
+	return int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+}
+
+func getQuotaExceededError(err error) (quotaErr *quotaExceededError, ok bool) {
+	ok = errors.As(err, &quotaErr)
+	return
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// rateLimiter gives each client a bucket of burst tokens refilled at rate tokens per second,
+// a request taking one token
+type rateLimiter struct {
+	sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*tokenBucket{}}
+}
+
+func (l *rateLimiter) allow(client string, now time.Time, rate float64, burstLimit int) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	burst := float64(burstLimit)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(rate))
+	}
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		l.pruneFullBuckets(now, rate, burst)
+		bucket = &tokenBucket{tokens: burst, updatedAt: now}
+		l.buckets[client] = bucket
+	}
+
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*rate)
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		missingTokens := 1 - bucket.tokens
+		return false, time.Duration(missingTokens / rate * float64(time.Second))
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// pruneFullBuckets forgets idle clients once there are too many of them, a full bucket
+// being the same as no bucket
+func (l *rateLimiter) pruneFullBuckets(now time.Time, rate, burst float64) {
+	if len(l.buckets) < maxIdleBucketCount {
+		return
+	}
+
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*rate >= burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// quotaCounter counts the events registered by each client during the current UTC day
+type quotaCounter struct {
+	sync.Mutex
+	day    time.Time
+	counts map[string]int
+}
+
+func newQuotaCounter() *quotaCounter {
+	return &quotaCounter{counts: map[string]int{}}
+}
+
+// consume takes count events from the quota of the client, all or nothing
+func (q *quotaCounter) consume(client string, count int) error {
+	if dailyEventQuota <= 0 || count == 0 {
+		return nil
+	}
+
+	now := clock.Now().UTC()
+	day := now.Truncate(24 * time.Hour)
+
+	q.Lock()
+	defer q.Unlock()
+
+	if !day.Equal(q.day) {
+		q.day = day
+		q.counts = map[string]int{}
+	}
+
+	if q.counts[client]+count > dailyEventQuota {
+		return &quotaExceededError{retryAfter: day.Add(24 * time.Hour).Sub(now)}
+	}
+
+	q.counts[client] += count
+	return nil
+}
+
+// refund gives back the events of a consumed count that the store did not register
+func (q *quotaCounter) refund(client string, count int) {
+	if dailyEventQuota <= 0 || count <= 0 {
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	if q.day.Equal(clock.Now().UTC().Truncate(24 * time.Hour)) {
+		q.counts[client] -= count
+	}
+}
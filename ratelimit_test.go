@@ -0,0 +1,250 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestRateLimit(t *testing.T) {
+	t.Run("Requests should return status code 429 once the client has no token left", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}}
+		stubClock := useStubClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+		useRateLimit(t, 0.5, 2)
+
+		for _, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			response := serveFrom(newGetRequest(api_url+"1"), "192.0.2.1:1234")
+			assertStatus(t, response.Code, want)
+		}
+
+		response := serveFrom(newGetRequest(api_url+"1"), "192.0.2.1:1234")
+		assertHeader(t, response, retryAfterHeader, "2")
+
+		response = serveFrom(newGetRequest(api_url+"1"), "192.0.2.2:1234")
+		assertStatus(t, response.Code, http.StatusOK)
+
+		stubClock.now = stubClock.now.Add(2 * time.Second)
+
+		response = serveFrom(newGetRequest(api_url+"1"), "192.0.2.1:5678")
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("Requests should be limited per API key rather than per address", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}, apiKeys: roleAPIKeys()}
+		useStubClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+		useAuthentication(t, "")
+		useRateLimit(t, 1, 1)
+
+		response := serveWithAPIKey(newGetRequest(api_url+"1"), "reader-key")
+		assertStatus(t, response.Code, http.StatusOK)
+
+		response = serveWithAPIKey(newGetRequest(api_url+"1"), "client-key")
+		assertStatus(t, response.Code, http.StatusOK)
+
+		response = serveWithAPIKey(newGetRequest(api_url+"1"), "reader-key")
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+	})
+}
+
+func TestDailyEventQuota(t *testing.T) {
+	t.Run("Post request should return status code 429 when the events exceed the daily quota", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		stubClock := useStubClock(t, time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC))
+		useDailyEventQuota(t, 3)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostRequestTo(api_url, []Event{validEvent1, validEvent2}))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPostRequestTo(api_url, []Event{validEvent4, validEvent5}))
+
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+		assertHeader(t, response, retryAfterHeader, "3600")
+		assertBatches(t, stub.spy.registeredBatches, [][]Event{{validEvent1, validEvent2}})
+
+		stubClock.now = stubClock.now.Add(time.Hour)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPostRequestTo(api_url, []Event{validEvent4, validEvent5}))
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("NDJSON ingestion should stop registering events once the daily quota is exceeded", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		useStubClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+		useDailyEventQuota(t, 3)
+		useIngestionChunkSize(t, 2)
+
+		response := httptest.NewRecorder()
+		body := strings.Join([]string{toJsonLine(validEvent1), toJsonLine(validEvent2), toJsonLine(validEvent4), toJsonLine(validEvent5), toJsonLine(validEvent1)}, "\n")
+		server.ServeHTTP(response, newNDJSONPostRequest(api_url, body))
+
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+		summary := getIngestionSummaryFromResponse(t, response)
+
+		if summary.AffectedLines != 2 || len(summary.Errors) != 3 {
+			t.Fatalf("incorrect summary %+v", summary)
+		}
+		for i, want := range []int{3, 4, 5} {
+			if summary.Errors[i].Line != want {
+				t.Errorf("incorrect line for error %d, got %d, want %d", i, summary.Errors[i].Line, want)
+			}
+		}
+		assertBatches(t, stub.spy.registeredBatches, [][]Event{{validEvent1, validEvent2}})
+	})
+
+	t.Run("Events the store fails to register should be given back to the daily quota", func(t *testing.T) {
+		useStubClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+		useDailyEventQuota(t, 2)
+
+		store = failingEventStore{&StubEventStore{spy: &Spy{}}}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newPostRequestTo(api_url, []Event{validEvent1, validEvent2}))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		store = failingEventStore{&StubEventStore{spy: &Spy{}}}
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newNDJSONPostRequest(api_url, toJsonLine(validEvent1)+"\n"+toJsonLine(validEvent2)))
+		assertStatus(t, response.Code, http.StatusOK)
+
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newPostRequestTo(api_url, []Event{validEvent1, validEvent2}))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertBatches(t, stub.spy.registeredBatches, [][]Event{{validEvent1, validEvent2}})
+	})
+
+	t.Run("WebSocket publish should be answered with an error when the daily quota is exceeded", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		useStubClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+		useDailyEventQuota(t, 1)
+		conn := dialWebsocket(t, api_url+"ws")
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsPublish, Id: "p1", Events: []Event{validEvent1, validEvent2}})
+		message := readWebsocketMessage(t, conn)
+
+		assertResponseBody(t, message.Type, wsError)
+		if !strings.Contains(message.Error, "quota") || message.RetryAfter != 12*60*60 {
+			t.Errorf("incorrect error %q, retry after %d", message.Error, message.RetryAfter)
+		}
+	})
+
+	t.Run("WebSocket publish should be limited as requests of the client", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+		useStubClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+		useRateLimit(t, 0.5, 2)
+		conn := dialWebsocket(t, api_url+"ws")
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsPublish, Id: "p1", Events: []Event{validEvent1}})
+		assertResponseBody(t, readWebsocketMessage(t, conn).Type, wsAck)
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsPublish, Id: "p2", Events: []Event{validEvent2}})
+		message := readWebsocketMessage(t, conn)
+
+		assertResponseBody(t, message.Type, wsError)
+		assertResponseBody(t, message.Id, "p2")
+		if message.Error != errRateLimitExceeded.Error() || message.RetryAfter != 2 {
+			t.Errorf("incorrect error %q, retry after %d", message.Error, message.RetryAfter)
+		}
+		if len(spy.registeredBatches) != 1 {
+			t.Errorf("only the first publish should be registered, got %d batches", len(spy.registeredBatches))
+		}
+	})
+}
+
+func TestIPRateLimit(t *testing.T) {
+	t.Run("Requests should be limited per address before their credentials are checked", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}, apiKeys: roleAPIKeys()}
+		useStubClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+		useAuthentication(t, "")
+		useIPRateLimit(t, 1, 2)
+
+		for _, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+			request := newGetRequest(api_url + "1")
+			request.Header.Set(apiKeyHeader, "guessed-key")
+			response := serveFrom(request, "192.0.2.1:1234")
+
+			assertStatus(t, response.Code, want)
+		}
+
+		request := newGetRequest(api_url + "1")
+		request.Header.Set(apiKeyHeader, "reader-key")
+		response := serveFrom(request, "192.0.2.1:1234")
+
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+		assertHeader(t, response, retryAfterHeader, "1")
+
+		response = serveFrom(request, "192.0.2.2:1234")
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+}
+
+// Test doubles
+// failingEventStore registers nothing, as a store whose insert transaction fails
+type failingEventStore struct {
+	*StubEventStore
+}
+
+func (s failingEventStore) ForTenant(tenant string) EventStore {
+	return s
+}
+
+func (s failingEventStore) RegisterNewEvents(eventList []Event, outbox OutboxRecord) int {
+	return 0
+}
+
+// Helpers
+func useIPRateLimit(t *testing.T, rate float64, burst int) {
+	t.Helper()
+
+	previousRate, previousBurst, previousLimiter := ipRateLimit, ipBurstLimit, ipLimiter
+	ipRateLimit, ipBurstLimit, ipLimiter = rate, burst, newRateLimiter()
+	t.Cleanup(func() {
+		ipRateLimit, ipBurstLimit, ipLimiter = previousRate, previousBurst, previousLimiter
+	})
+}
+
+func useRateLimit(t *testing.T, rate float64, burst int) {
+	t.Helper()
+
+	previousRate, previousBurst, previousLimiter := requestRateLimit, requestBurstLimit, requestLimiter
+	requestRateLimit, requestBurstLimit, requestLimiter = rate, burst, newRateLimiter()
+	t.Cleanup(func() {
+		requestRateLimit, requestBurstLimit, requestLimiter = previousRate, previousBurst, previousLimiter
+	})
+}
+
+func useDailyEventQuota(t *testing.T, quota int) {
+	t.Helper()
+
+	previousQuota, previousQuotas := dailyEventQuota, eventQuotas
+	dailyEventQuota, eventQuotas = quota, newQuotaCounter()
+	t.Cleanup(func() { dailyEventQuota, eventQuotas = previousQuota, previousQuotas })
+}
+
+func useStubClock(t *testing.T, now time.Time) *StubClock {
+	t.Helper()
+
+	stubClock := &StubClock{now: now}
+	clock = stubClock
+	t.Cleanup(func() { clock = MockClock{} })
+
+	return stubClock
+}
+
+func serveFrom(request *http.Request, remoteAddr string) *httptest.ResponseRecorder {
+	request.RemoteAddr = remoteAddr
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, request)
+
+	return response
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	readPermission   = "read"
+	writePermission  = "write"
+	deletePermission = "delete"
+	adminPermission  = "admin"
+
+	readerRole = "reader"
+	clientRole = "client"
+	staffRole  = "staff"
+	adminRole  = "admin"
+
+	rolesClaim = "roles"
+)
+
+var rolePermissions = map[string][]string{
+	readerRole: {readPermission},
+	clientRole: {readPermission, writePermission},
+	staffRole:  {readPermission, writePermission, deletePermission},
+	adminRole:  {readPermission, writePermission, deletePermission, adminPermission},
+}
+
+// withPermission answers 403 to authenticated principals lacking the permission,
+// every request being allowed when authentication is disabled
+func withPermission(permission string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAllowed(r, permission) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// withOperatorPermission reserves to the bootstrap key the administration shared by every tenant,
+// the flag catalog and the collections, answering 403 to the admins of a tenant
+func withOperatorPermission(handler http.HandlerFunc) http.HandlerFunc {
+	return withPermission(adminPermission, func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := getPrincipal(r); ok && !principal.bootstrap {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		handler(w, r)
+	})
+}
+
+func isAllowed(r *http.Request, permission string) bool {
+	principal, ok := getPrincipal(r)
+	return !ok || principal.hasPermission(permission)
+}
+
+func (p Principal) hasPermission(permission string) bool {
+	for _, role := range p.Roles {
+		for _, value := range rolePermissions[role] {
+			if value == permission {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p Principal) hasAnyRole(roles []string) bool {
+	for _, role := range p.Roles {
+		for _, value := range roles {
+			if value == role {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isValidRoleList(roles []string) bool {
+	for _, role := range roles {
+		if _, ok := rolePermissions[role]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getRolesFromClaims(claims map[string]interface{}) (roles []string) {
+	values, _ := claims[rolesClaim].([]interface{})
+
+	for _, value := range values {
+		if role, ok := value.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+
+	return
+}
+
+// getHiddenFlags returns the flags restricted to roles the principal does not have,
+// admins reading every flag
+func getHiddenFlags(r *http.Request) (hiddenFlags []int) {
+	principal, ok := getPrincipal(r)
+	if !ok || principal.hasAnyRole([]string{adminRole}) {
+		return
+	}
+
+	for _, flag := range store.GetAllFlags() {
+		if len(flag.ReadRoles) > 0 && !principal.hasAnyRole(flag.ReadRoles) {
+			hiddenFlags = append(hiddenFlags, flag.Id)
+		}
+	}
+
+	return
+}
+
+func isHiddenEvent(event Event, hiddenFlags []int) bool {
+	for _, flag := range hiddenFlags {
+		if contains(event.Flags, flag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flagFilteredStore hides the events carrying a hidden flag from every read, and protects them from deletes
+type flagFilteredStore struct {
+	EventStore
+	hiddenFlags []int
+}
+
+func (s flagFilteredStore) GetEventById(id int) Event {
+	event := s.EventStore.GetEventById(id)
+	if isHiddenEvent(event, s.hiddenFlags) {
+		return Event{}
+	}
+
+	return event
+}
+
+func (s flagFilteredStore) GetAllEvents() []Event {
+	return s.filter(s.EventStore.GetAllEvents())
+}
+
+func (s flagFilteredStore) GetEventsByFlag(flag int) []Event {
+	if contains(s.hiddenFlags, flag) {
+		return nil
+	}
+
+	return s.filter(s.EventStore.GetEventsByFlag(flag))
+}
+
+func (s flagFilteredStore) GetFlagStats(from, to time.Time, excludedFlags []int) []FlagStats {
+	return s.EventStore.GetFlagStats(from, to, append(append([]int{}, excludedFlags...), s.hiddenFlags...))
+}
+
+func (s flagFilteredStore) StreamAllEvents(yield func(Event) bool) {
+	s.EventStore.StreamAllEvents(s.filterYield(yield))
+}
+
+func (s flagFilteredStore) StreamEventsByFlag(flag int, yield func(Event) bool) {
+	if !contains(s.hiddenFlags, flag) {
+		s.EventStore.StreamEventsByFlag(flag, s.filterYield(yield))
+	}
+}
+
+func (s flagFilteredStore) StreamEventsAfterId(id int, yield func(Event) bool) {
+	s.EventStore.StreamEventsAfterId(id, s.filterYield(yield))
+}
+
+func (s flagFilteredStore) StreamEventsBetween(from, to time.Time, yield func(Event) bool) {
+	s.EventStore.StreamEventsBetween(from, to, s.filterYield(yield))
+}
+
+// GetChangesSince keeps the last sequence of the page, hidden changes included, so that the
+// client resumes after them
+func (s flagFilteredStore) GetChangesSince(sequence int64, limit int) (changeList []Change, lastSequence int64) {
+	changes, lastSequence := s.EventStore.GetChangesSince(sequence, limit)
+	for _, change := range changes {
+		if !isHiddenEvent(change.Event, s.hiddenFlags) {
+			changeList = append(changeList, change)
+		}
+	}
+
+	return
+}
+
+func (s flagFilteredStore) DeleteById(id int) int {
+	if isHiddenEvent(s.EventStore.GetEventById(id), s.hiddenFlags) {
+		return 0
+	}
+
+	return s.EventStore.DeleteById(id)
+}
+
+func (s flagFilteredStore) DeleteByFlag(flag int) int {
+	if contains(s.hiddenFlags, flag) {
+		return 0
+	}
+
+	return s.EventStore.DeleteByFlag(flag)
+}
+
+func (s flagFilteredStore) filter(eventList []Event) []Event {
+	visibleEvents := []Event{}
+	for _, event := range eventList {
+		if !isHiddenEvent(event, s.hiddenFlags) {
+			visibleEvents = append(visibleEvents, event)
+		}
+	}
+
+	return visibleEvents
+}
+
+func (s flagFilteredStore) filterYield(yield func(Event) bool) func(Event) bool {
+	return func(event Event) bool {
+		return isHiddenEvent(event, s.hiddenFlags) || yield(event)
+	}
+}
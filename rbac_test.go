@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+var antiCheatFlag = Flag{Id: 12, Name: "anti-cheat", Description: "Suspicious behaviour reports", ReadRoles: []string{staffRole}}
+var antiCheatEvent = Event{Id: 3, Timestamp: validEvent1.Timestamp, Flags: []int{12, 2}, Data: `{"speed": 9000}`}
+
+func TestRoleBasedAuthorization(t *testing.T) {
+	t.Run("Routes should return status code 403 when the role lacks the permission", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1}, spy: &Spy{}, apiKeys: roleAPIKeys()}
+		useAuthentication(t, "")
+
+		cases := []struct {
+			request *http.Request
+			key     string
+			want    int
+		}{
+			{newGetRequest(api_url + "1"), "reader-key", http.StatusOK},
+			{newPostRequestTo(api_url, []Event{validEvent2}), "reader-key", http.StatusForbidden},
+			{newPostRequestTo(api_url, []Event{validEvent2}), "client-key", http.StatusOK},
+			{newDeleteRequest(api_url + "1"), "client-key", http.StatusForbidden},
+			{newDeleteRequest(api_url + "1"), "staff-key", http.StatusOK},
+			{newGetRequest(webhooks_url), "staff-key", http.StatusForbidden},
+			{newRequestWithBody(http.MethodPost, flags_url, locationFlag), "staff-key", http.StatusForbidden},
+			{newGetRequest(apikeys_url), "admin-key", http.StatusOK},
+		}
+
+		for _, c := range cases {
+			c.request.Header.Set(apiKeyHeader, c.key)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, c.request)
+
+			if response.Code != c.want {
+				t.Errorf("%s %s with %s: got status %d, want %d", c.request.Method, c.request.URL, c.key, response.Code, c.want)
+			}
+		}
+	})
+
+	t.Run("Events carrying a restricted flag should be hidden from other roles", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1, antiCheatEvent}, flags: []Flag{antiCheatFlag}, apiKeys: roleAPIKeys()}
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newGetRequest(api_url), "client-key")
+		assertStatus(t, response.Code, http.StatusOK)
+		assertEventList(t, getEventListFromResponse(t, response.Body), []Event{validEvent1})
+
+		response = serveWithAPIKey(newGetRequest(api_url+"getFlag/2"), "client-key")
+		assertEventList(t, getEventListFromResponse(t, response.Body), []Event{validEvent1})
+
+		for _, target := range []string{api_url + "3", api_url + "getFlag/12", flags_url + "12"} {
+			response = serveWithAPIKey(newGetRequest(target), "client-key")
+			assertStatus(t, response.Code, http.StatusNotFound)
+		}
+
+		response = serveWithAPIKey(newGetRequest(flags_url), "client-key")
+		assertResponseBody(t, response.Body.String(), "[]\n")
+	})
+
+	t.Run("Events carrying a restricted flag should be readable by the allowed roles", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{validEvent1, antiCheatEvent}, flags: []Flag{antiCheatFlag}, apiKeys: roleAPIKeys()}
+		useAuthentication(t, "")
+
+		for _, key := range []string{"staff-key", "admin-key"} {
+			response := serveWithAPIKey(newGetRequest(api_url+"getFlag/12"), key)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertEventList(t, getEventListFromResponse(t, response.Body), []Event{antiCheatEvent})
+		}
+	})
+
+	t.Run("Delete request should not neutralize events carrying a restricted flag", func(t *testing.T) {
+		stub := &StubEventStore{events: []Event{antiCheatEvent}, flags: []Flag{antiCheatFlag}, spy: &Spy{}, apiKeys: []APIKey{{Id: 1, Name: "moderator", Roles: []string{clientRole, staffRole}, Hash: hashAPIKey("moderator-key")}}}
+		stub.flags[0].ReadRoles = []string{adminRole}
+		store = stub
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newDeleteRequest(api_url+"deleteflag/12"), "moderator-key")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "{\"affectedlines\":0}")
+		assertEvent(t, stub.events[0], antiCheatEvent)
+	})
+
+	t.Run("Subscriptions should not receive events carrying a hidden flag", func(t *testing.T) {
+		s := &subscription{hiddenFlags: []int{12}}
+
+		if s.matches(antiCheatEvent) || !s.matches(validEvent1) {
+			t.Errorf("subscription should only match events without hidden flags")
+		}
+	})
+
+	t.Run("WebSocket publish should be refused without the write permission", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}, apiKeys: roleAPIKeys()}
+		useAuthentication(t, "")
+		testServer := httptest.NewServer(server)
+		defer testServer.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(testServer.URL, "http")+api_url+"ws", http.Header{apiKeyHeader: {"reader-key"}})
+		assertNoError(t, err)
+		defer conn.Close()
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsPublish, Id: "p1", Events: []Event{validEvent1}})
+
+		assertResponseBody(t, readWebsocketMessage(t, conn).Type, wsError)
+	})
+}
+
+func TestRolesFromClaims(t *testing.T) {
+	var claims map[string]interface{}
+	_ = json.Unmarshal([]byte(`{"roles": ["client", 3, "staff"]}`), &claims)
+
+	got := getRolesFromClaims(claims)
+
+	if strings.Join(got, ",") != "client,staff" {
+		t.Errorf("incorrect roles: got %v", got)
+	}
+}
+
+// Helpers
+func roleAPIKeys() (apiKeys []APIKey) {
+	for i, role := range []string{readerRole, clientRole, staffRole, adminRole} {
+		apiKeys = append(apiKeys, APIKey{Id: i + 1, Name: role, Roles: []string{role}, Hash: hashAPIKey(role + "-key")})
+	}
+
+	return
+}
+
+func serveWithAPIKey(request *http.Request, key string) *httptest.ResponseRecorder {
+	request.Header.Set(apiKeyHeader, key)
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, request)
+
+	return response
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// compiledSchemas caches the compiled schemas by their text, a schema being evicted when the flag
+// it belonged to is updated or deleted
+var compiledSchemas sync.Map
+
+type eventError struct {
+	Index  int      `json:"index"`
+	Errors []string `json:"errors"`
+}
+
+func compileSchema(schema string) (*jsonschema.Schema, error) {
+	if compiled, ok := compiledSchemas.Load(schema); ok {
+		return compiled.(*jsonschema.Schema), nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = rejectExternalSchema
+
+	if err := compiler.AddResource("schema.json", strings.NewReader(schema)); err != nil {
+		return nil, err
+	}
+
+	compiled, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, err
+	}
+
+	compiledSchemas.Store(schema, compiled)
+	return compiled, nil
+}
+
+// rejectExternalSchema keeps $ref within the schema, so that a flag cannot make the server read
+// its files or request other hosts
+func rejectExternalSchema(url string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("external schema %s is not allowed", url)
+}
+
+func forgetSchema(schema string) {
+	compiledSchemas.Delete(schema)
+}
+
+func isValidSchema(schema string) bool {
+	if schema == "" {
+		return true
+	}
+
+	_, err := compileSchema(schema)
+	return err == nil
+}
+
+// getSchemaViolations validates the Data of an event against the schema of each of its flags
+func getSchemaViolations(event Event) (violations []string) {
+	var data interface{}
+	if json.Unmarshal([]byte(event.Data), &data) != nil {
+		return []string{"data is not valid json"}
+	}
+
+	for _, flagId := range event.Flags {
+		flag := store.GetFlagById(flagId)
+		if flag.Schema == "" {
+			continue
+		}
+
+		schema, err := compileSchema(flag.Schema)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("flag %d: invalid schema: %v", flagId, err))
+			continue
+		}
+
+		var validationError *jsonschema.ValidationError
+		if err := schema.Validate(data); errors.As(err, &validationError) {
+			for _, message := range flattenValidationError(validationError) {
+				violations = append(violations, fmt.Sprintf("flag %d: %s", flagId, message))
+			}
+		} else if err != nil {
+			violations = append(violations, fmt.Sprintf("flag %d: %v", flagId, err))
+		}
+	}
+
+	return
+}
+
+func flattenValidationError(validationError *jsonschema.ValidationError) (messages []string) {
+	if len(validationError.Causes) == 0 {
+		location := validationError.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{fmt.Sprintf("%s: %s", location, validationError.Message)}
+	}
+
+	for _, cause := range validationError.Causes {
+		messages = append(messages, flattenValidationError(cause)...)
+	}
+
+	return
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPostRequestWithSchema(t *testing.T) {
+	t.Run("Post request should register only events whose data matches the schemas of their flags", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy, flags: []Flag{timerFlag}}
+
+		eventList := []Event{validEvent1, validTimerEvent, invalidTimerEvent}
+
+		request := newPostRequest(eventList)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := registerResponse{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		want := registerResponse{
+			AffectedLines: 2,
+			Errors: []eventError{{
+				Index: 2,
+				Errors: []string{
+					"flag 4: /timer_niveau4: expected integer, but got string",
+				},
+			}},
+		}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertEventList(t, spy.listGivenAsParameter, []Event{validEvent1, validTimerEvent})
+		assertRegisterResponse(t, got, want)
+	})
+
+	t.Run("Post request should report every violation of an event", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}, flags: []Flag{timerFlag}}
+
+		event := validTimerEvent
+		event.Data = `{"timer_niveau4": -5, "level": 4}`
+
+		request := newPostRequest([]Event{event})
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := registerResponse{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if got.AffectedLines != 0 || len(got.Errors) != 1 || len(got.Errors[0].Errors) != 2 {
+			t.Errorf("expected two violations for the event, got %+v", got)
+		}
+	})
+}
+
+func TestPostFlagRequestWithSchema(t *testing.T) {
+	t.Run("Post request should return status code 422 when schema cannot be compiled", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		flag := Flag{Id: 4, Name: "timer", Schema: `{"type": "unknown"}`}
+
+		request := newRequestWithBody(http.MethodPost, flags_url, flag)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("Post request should return status code 422 when schema references an external schema", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		localSchema := filepath.Join(t.TempDir(), "schema.json")
+		_ = os.WriteFile(localSchema, []byte(`{"type": "object"}`), 0o600)
+
+		for _, schema := range []string{`{"$ref": "file://` + localSchema + `"}`, `{"$ref": "https://example.com/schema.json"}`} {
+			flag := Flag{Id: 4, Name: "timer", Schema: schema}
+
+			request := newRequestWithBody(http.MethodPost, flags_url, flag)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("Post request should accept references within the schema", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+
+		flag := Flag{Id: 4, Name: "timer", Schema: `{"$defs": {"timer": {"type": "integer"}}, "properties": {"timer_niveau4": {"$ref": "#/$defs/timer"}}}`}
+
+		request := newRequestWithBody(http.MethodPost, flags_url, flag)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+}
+
+func TestCompiledSchemaCache(t *testing.T) {
+	t.Run("Updated and deleted flags should evict their previous schema", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}, flags: []Flag{timerFlag}}
+
+		postEventsTo(t, api_url, []Event{validTimerEvent})
+		assertSchemaCached(t, timerFlag.Schema, true)
+
+		updatedFlag := timerFlag
+		updatedFlag.Schema = `{"type": "object"}`
+		server.ServeHTTP(httptest.NewRecorder(), newRequestWithBody(http.MethodPut, flags_url+"4", updatedFlag))
+
+		assertSchemaCached(t, timerFlag.Schema, false)
+		assertSchemaCached(t, updatedFlag.Schema, true)
+
+		server.ServeHTTP(httptest.NewRecorder(), newDeleteRequest(flags_url+"4"))
+
+		assertSchemaCached(t, updatedFlag.Schema, false)
+	})
+}
+
+// Data
+var timerFlag = Flag{
+	Id:     4,
+	Name:   "timer",
+	Schema: `{"type": "object", "required": ["timer_niveau4"], "properties": {"timer_niveau4": {"type": "integer", "minimum": 0}, "level": {"type": "string"}}}`,
+}
+
+var validTimerEvent = Event{
+	Id:        10,
+	Timestamp: time.Date(2020, time.November, 13, 20, 1, 49, 0, time.UTC),
+	Flags:     []int{4, 2},
+	Data:      `{"timer_niveau4": 1254}`,
+}
+
+var invalidTimerEvent = Event{
+	Id:        11,
+	Timestamp: time.Date(2020, time.November, 13, 20, 1, 49, 0, time.UTC),
+	Flags:     []int{4},
+	Data:      `{"timer_niveau4": "1254"}`,
+}
+
+// Helpers
+func assertSchemaCached(t *testing.T, schema string, want bool) {
+	t.Helper()
+
+	if _, got := compiledSchemas.Load(schema); got != want {
+		t.Errorf("schema %s cached: got %v, want %v", schema, got, want)
+	}
+}
+
+func assertRegisterResponse(t *testing.T, got, want registerResponse) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect register response:\ngot %+v\nwant %+v", got, want)
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -15,7 +17,8 @@ import (
 
 const (
 	jsonContentType       = "application/json"
-	api_url               = "/api/game-event/"
+	api_route             = "/api/{controller}/"
+	api_url               = "/api/" + defaultController + "/"
 	lineNumberResponseKey = "affectedlines"
 )
 
@@ -23,98 +26,256 @@ var neutralTimestampValue = time.Unix(0, 0)
 var neutralFlagsValue = []int{-1}
 var neutralDataValue = "{}"
 
+var eventCodecs = map[string]eventCodec{
+	jsonContentType:     jsonCodec{},
+	msgpackContentType:  msgpackCodec{},
+	protobufContentType: protobufCodec{},
+}
+
+type eventCodec interface {
+	contentType() string
+	encodeEvent(event Event) ([]byte, error)
+	encodeEventList(eventList []Event) ([]byte, error)
+	decodeEventList(data []byte) ([]Event, error)
+}
+
+type registerResponse struct {
+	AffectedLines int          `json:"affectedlines"`
+	Errors        []eventError `json:"errors,omitempty"`
+}
+
+// Tenant and Hash are never taken from requests: stores set them to the tenant they are
+// scoped to and to the link of the event in the hash chain of the tenant
 type Event struct {
 	Id        int       `json:"id"`
 	Timestamp time.Time `json:"timestamp"`
 	Flags     []int     `json:"flags"`
 	Data      string    `json:"data"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
 }
 
 func newServer() http.Handler {
 	router := mux.NewRouter()
+	router.Use(corsMiddleware, ipRateLimitMiddleware, authenticationMiddleware, rateLimitMiddleware, decompressionMiddleware, bodyLimitMiddleware, compressionMiddleware)
+
+	// CORS preflight requests, answered by corsMiddleware
+	router.PathPrefix(preflightRoutePathPrefix).Methods(http.MethodOptions).HandlerFunc(preflightHandler)
+
+	// Flag catalog
+	router.HandleFunc(flags_url, withPermission(readPermission, getAllFlagsHandler)).Methods(http.MethodGet)
+	router.HandleFunc(flags_url+"{id}", withPermission(readPermission, getFlagByIdHandler)).Methods(http.MethodGet)
+	router.HandleFunc(flags_url, withOperatorPermission(postFlagHandler)).Methods(http.MethodPost)
+	router.HandleFunc(flags_url+"{id}", withOperatorPermission(putFlagHandler)).Methods(http.MethodPut)
+	router.HandleFunc(flags_url+"{id}", withOperatorPermission(deleteFlagHandler)).Methods(http.MethodDelete)
+
+	// Collections administration
+	router.HandleFunc(collections_url, withOperatorPermission(getAllCollectionsHandler)).Methods(http.MethodGet)
+	router.HandleFunc(collections_url, withOperatorPermission(postCollectionHandler)).Methods(http.MethodPost)
+	router.HandleFunc(collections_url+"{name}", withOperatorPermission(deleteCollectionHandler)).Methods(http.MethodDelete)
+
+	// Webhooks administration
+	router.HandleFunc(webhooks_url, withPermission(adminPermission, getAllWebhooksHandler)).Methods(http.MethodGet)
+	router.HandleFunc(webhooks_url, withPermission(adminPermission, postWebhookHandler)).Methods(http.MethodPost)
+	router.HandleFunc(webhooks_url+"{id}", withPermission(adminPermission, getWebhookByIdHandler)).Methods(http.MethodGet)
+	router.HandleFunc(webhooks_url+"{id}", withPermission(adminPermission, deleteWebhookHandler)).Methods(http.MethodDelete)
+	router.HandleFunc(webhooks_url+"{id}/deliveries", withPermission(adminPermission, getDeliveriesHandler)).Methods(http.MethodGet)
+
+	// API keys administration
+	router.HandleFunc(apikeys_url, withPermission(adminPermission, getAllAPIKeysHandler)).Methods(http.MethodGet)
+	router.HandleFunc(apikeys_url, withPermission(adminPermission, postAPIKeyHandler)).Methods(http.MethodPost)
+	router.HandleFunc(apikeys_url+"{id}", withPermission(adminPermission, deleteAPIKeyHandler)).Methods(http.MethodDelete)
+
+	// Audit log
+	router.HandleFunc(audit_url, withPermission(adminPermission, getAuditEntriesHandler)).Methods(http.MethodGet)
 
 	// GET requests
-	router.HandleFunc(api_url+"{id}", getByIdHandler).Methods(http.MethodGet)
-	router.HandleFunc(api_url, getAllHandler).Methods(http.MethodGet)
-	router.HandleFunc(api_url+"getFlag/{id}", getByFlagHandler).Methods(http.MethodGet)
+	router.HandleFunc(api_route+"aggregate", withPermission(readPermission, withEventStore(aggregateHandler))).Methods(http.MethodGet)
+	router.HandleFunc(api_route+"stats/flags", withPermission(readPermission, withEventStore(flagStatsHandler))).Methods(http.MethodGet)
+	router.HandleFunc(api_route+"stream", withPermission(readPermission, withEventStore(streamHandler))).Methods(http.MethodGet)
+	router.HandleFunc(api_route+"changes", withPermission(readPermission, withEventStore(changesHandler))).Methods(http.MethodGet)
+	router.HandleFunc(api_route+"ws", withPermission(readPermission, withEventStore(websocketHandler))).Methods(http.MethodGet)
+	router.HandleFunc(api_route+"verify", withPermission(adminPermission, withEventStore(verifyChainHandler))).Methods(http.MethodGet)
+	router.HandleFunc(api_route+"{id}", withPermission(readPermission, withEventStore(getByIdHandler))).Methods(http.MethodGet)
+	router.HandleFunc(api_route, withPermission(readPermission, withEventStore(getAllHandler))).Methods(http.MethodGet)
+	router.HandleFunc(api_route+"getFlag/{flag}", withPermission(readPermission, withEventStore(getByFlagHandler))).Methods(http.MethodGet)
 
 	// POST request
-	router.HandleFunc(api_url, postHandler).Methods(http.MethodPost)
+	router.HandleFunc(api_route, withPermission(writePermission, withEventStore(postHandler))).Methods(http.MethodPost)
 
 	// DELETE requests
-	router.HandleFunc(api_url+"{id}", deleteByIdHandler).Methods(http.MethodDelete)
-	router.HandleFunc(api_url+"deleteflag/{id}", deleteByFlagHandler).Methods(http.MethodDelete)
+	router.HandleFunc(api_route+"{id}", withPermission(deletePermission, withEventStore(deleteByIdHandler))).Methods(http.MethodDelete)
+	router.HandleFunc(api_route+"deleteflag/{flag}", withPermission(deletePermission, withEventStore(deleteByFlagHandler))).Methods(http.MethodDelete)
 
 	return router
 }
 
-func getByIdHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := extractIntFromURL(r, api_url)
+func getByIdHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	id, err := extractIntFromURL(r, "id")
 
 	if err != nil {
 		w.WriteHeader(http.StatusUnprocessableEntity)
 	} else {
-		event := store.GetEventById(id)
-		sendEvent(event, w)
+		event := eventStore.GetEventById(id)
+		sendEvent(event, w, r)
 	}
 }
 
-func getAllHandler(w http.ResponseWriter, r *http.Request) {
-	listEvent := store.GetAllEvents()
-	writeResponseBody(w, &listEvent)
+func getAllHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	if isStreamRequested(r) {
+		streamEvents(w, r, eventStore.StreamAllEvents)
+		return
+	}
+
+	listEvent := eventStore.GetAllEvents()
+	writeEventList(listEvent, w, r)
 }
 
-func getByFlagHandler(w http.ResponseWriter, r *http.Request) {
-	flag, err := extractIntFromURL(r, api_url+"getFlag/")
+func getByFlagHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	flag, err := extractFlagFromURL(r, "flag")
 
 	if err != nil {
 		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else if isStreamRequested(r) {
+		streamEvents(w, r, func(yield func(Event) bool) {
+			eventStore.StreamEventsByFlag(flag, yield)
+		})
 	} else {
-		eventList := store.GetEventsByFlag(flag)
-		sentEventList(eventList, w)
+		eventList := eventStore.GetEventsByFlag(flag)
+		sentEventList(eventList, w, r)
 	}
 }
 
-func postHandler(w http.ResponseWriter, r *http.Request) {
-	eventList := getEventListFromRequest(r)
-	validEventList := getValidEventList(eventList)
+func postHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	if hasContentType(r, ndjsonContentType) {
+		postNDJSONHandler(w, r, eventStore)
+		return
+	}
+
+	if hasContentType(r, csvContentType) {
+		postCSVHandler(w, r, eventStore)
+		return
+	}
+
+	eventList, err := getEventListFromRequest(r)
+	if errors.Is(err, errBodyTooLarge) || errors.Is(err, errBatchTooLong) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	affectedLines, rejectedEvents, err := registerEvents(eventStore, mux.Vars(r)["controller"], getClientId(r), getTenant(r), eventList)
+	if quotaErr, ok := getQuotaExceededError(err); ok {
+		writeTooManyRequests(w, quotaErr.retryAfter)
+		return
+	}
 
-	affectedLines := store.RegisterNewEvents(validEventList)
-	_, _ = w.Write(formatLineNumberResponse(affectedLines))
+	_, _ = w.Write(formatRegisterResponse(affectedLines, rejectedEvents))
 }
 
-func deleteByIdHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := extractIntFromURL(r, api_url)
+// registerEvents stores the valid events of the list, the outbox relay then publishes them to the subscribers of the collection.
+// Nothing is stored when the valid events exceed the daily quota of the client, and the events the store fails to register are given back to the quota.
+func registerEvents(eventStore EventStore, collection, client, tenant string, eventList []Event) (affectedLines int, rejectedEvents []eventError, err error) {
+	validEventList, rejectedEvents := getValidEventList(eventList, tenant)
+
+	if err = eventQuotas.consume(client, len(validEventList)); err != nil {
+		return
+	}
+
+	affectedLines = eventStore.RegisterNewEvents(validEventList, newOutboxRecord(collection))
+	eventQuotas.refund(client, len(validEventList)-affectedLines)
+	if affectedLines > 0 {
+		signalOutbox()
+	}
+
+	return
+}
+
+// publishCreatedEvents notifies the stream subscribers and the webhooks of the collection
+func publishCreatedEvents(collection string, eventList []Event) {
+	broker.publish(collection, eventList)
+	notifyCreatedEvents(collection, eventList)
+}
+
+func deleteByIdHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	id, err := extractIntFromURL(r, "id")
 
 	if err != nil {
 		w.WriteHeader(http.StatusUnprocessableEntity)
 	} else {
-		affectedLines := store.DeleteById(id)
+		event := eventStore.GetEventById(id)
+
+		affectedLines, err := auditAction(r, nil, func() int { return eventStore.DeleteById(id) })
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if affectedLines > 0 {
+			notifyDeletedEvent(mux.Vars(r)["controller"], event)
+		}
+
 		_, _ = w.Write(formatLineNumberResponse(affectedLines))
 	}
 }
 
-func deleteByFlagHandler(w http.ResponseWriter, r *http.Request) {
-	flag, err := extractIntFromURL(r, api_url+"deleteflag/")
+func deleteByFlagHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	flag, err := extractFlagFromURL(r, "flag")
 
 	if err != nil {
 		w.WriteHeader(http.StatusUnprocessableEntity)
 	} else {
-		affectedLines := store.DeleteByFlag(flag)
+		affectedLines, err := auditAction(r, nil, func() int { return eventStore.DeleteByFlag(flag) })
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if affectedLines > 0 {
+			notifyDeletedFlag(mux.Vars(r)["controller"], getTenant(r), flag, affectedLines)
+		}
+
 		_, _ = w.Write(formatLineNumberResponse(affectedLines))
 	}
 }
 
-func extractIntFromURL(r *http.Request, prefix string) (int, error) {
-	return strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix))
+func extractIntFromURL(r *http.Request, key string) (int, error) {
+	return strconv.Atoi(mux.Vars(r)[key])
+}
+
+func hasContentType(r *http.Request, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("content-type"))
+	return mediaType == contentType
+}
+
+func accepts(r *http.Request, contentType string) bool {
+	for _, accepted := range strings.Split(r.Header.Get("accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(accepted); mediaType == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+func errMissingParameter(name string) error {
+	return fmt.Errorf("missing parameter %s", name)
 }
 
-func sendEvent(event Event, w http.ResponseWriter) {
+func errInvalidParameter(name string) error {
+	return fmt.Errorf("invalid value for parameter %s", name)
+}
+
+func sendEvent(event Event, w http.ResponseWriter, r *http.Request) {
 	if isEmptyEvent(event) {
 		w.WriteHeader(http.StatusNotFound)
 	} else {
-		w.Header().Set("content-type", jsonContentType)
-		writeResponseBody(w, &event)
+		codec := negotiateCodec(r)
+		body, _ := codec.encodeEvent(event)
+
+		w.Header().Set("content-type", codec.contentType())
+		_, _ = w.Write(body)
 	}
 }
 
@@ -126,25 +287,64 @@ func writeResponseBody(w http.ResponseWriter, content interface{}) {
 	_ = json.NewEncoder(w).Encode(content)
 }
 
-func sentEventList(eventList []Event, w http.ResponseWriter) {
+func sentEventList(eventList []Event, w http.ResponseWriter, r *http.Request) {
 	if isEmptyEventList(eventList) {
 		w.WriteHeader(http.StatusNotFound)
 	} else {
-		writeResponseBody(w, &eventList)
+		writeEventList(eventList, w, r)
 	}
 }
 
+func writeEventList(eventList []Event, w http.ResponseWriter, r *http.Request) {
+	codec := negotiateCodec(r)
+	body, _ := codec.encodeEventList(eventList)
+
+	w.Header().Set("content-type", codec.contentType())
+	_, _ = w.Write(body)
+}
+
 func isEmptyEventList(eventList []Event) bool {
 	return len(eventList) == 0
 }
 
-func getEventListFromRequest(r *http.Request) []Event {
-	dataSent, _ := ioutil.ReadAll(r.Body)
+// getEventListFromRequest reports errors reading the body and batches longer than maxBatchLength.
+// An undecodable body gives an empty list, unless in strict mode
+func getEventListFromRequest(r *http.Request) ([]Event, error) {
+	dataSent, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
 
-	eventList := []Event{}
-	_ = json.Unmarshal(dataSent, &eventList)
+	eventList, err := getRequestCodec(r).decodeEventList(dataSent)
+	if err != nil && strictJSON {
+		return nil, err
+	}
+
+	if isBatchTooLong(eventList) {
+		return nil, errBatchTooLong
+	}
 
-	return eventList
+	return eventList, nil
+}
+
+// negotiateCodec returns the codec of the first media type of the Accept header the server
+// knows, JSON being used by default
+func negotiateCodec(r *http.Request) eventCodec {
+	for _, accepted := range strings.Split(r.Header.Get("accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(accepted)
+		if codec, ok := eventCodecs[mediaType]; ok {
+			return codec
+		}
+	}
+	return jsonCodec{}
+}
+
+func getRequestCodec(r *http.Request) eventCodec {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("content-type"))
+	if codec, ok := eventCodecs[mediaType]; ok {
+		return codec
+	}
+	return jsonCodec{}
 }
 
 func formatLineNumberResponse(lineNumber int) []byte {
@@ -153,19 +353,55 @@ func formatLineNumberResponse(lineNumber int) []byte {
 	return responseAsBytes
 }
 
-func getValidEventList(eventList []Event) (validEventList []Event) {
-	for _, event := range eventList {
-		if isValidEvent(event) {
-			setValidTime(&event)
-			validEventList = append(validEventList, event)
+func formatRegisterResponse(lineNumber int, rejectedEvents []eventError) []byte {
+	response := registerResponse{AffectedLines: lineNumber, Errors: rejectedEvents}
+
+	responseAsBytes, _ := json.Marshal(response)
+	return responseAsBytes
+}
+
+func getValidEventList(eventList []Event, tenant string) (validEventList []Event, rejectedEvents []eventError) {
+	for i, event := range eventList {
+		violations := getInvalidityReasons(event)
+		if len(violations) == 0 {
+			violations = getSchemaViolations(event)
+		}
+
+		if len(violations) > 0 {
+			rejectedEvents = append(rejectedEvents, eventError{Index: i, Errors: violations})
+			continue
 		}
+
+		setValidTime(&event)
+		setServerFields(&event, tenant)
+		validEventList = append(validEventList, event)
 	}
 
 	return
 }
 
-func isValidEvent(event Event) bool {
-	return len(event.Flags) >= 1 && event.Data != "" && isJson(event.Data)
+func getInvalidityReasons(event Event) (reasons []string) {
+	if len(event.Flags) < 1 {
+		reasons = append(reasons, "flags must contain at least one value")
+	}
+
+	if contains(event.Flags, neutralFlagsValue[0]) {
+		reasons = append(reasons, fmt.Sprintf("flag %d is reserved for deleted events", neutralFlagsValue[0]))
+	}
+
+	if event.Data == "" || !isJson(event.Data) {
+		reasons = append(reasons, "data must be a json string")
+	}
+
+	reasons = append(reasons, getDataSizeViolation(event)...)
+
+	if rejectUnregisteredFlags {
+		for _, flag := range getUnregisteredFlags(event) {
+			reasons = append(reasons, fmt.Sprintf("flag %d is not registered", flag))
+		}
+	}
+
+	return
 }
 
 func isJson(stringToTest string) bool {
@@ -178,3 +414,18 @@ func setValidTime(event *Event) {
 		event.Timestamp = clock.Now()
 	}
 }
+
+// setServerFields overwrites the fields that only the server sets, whatever the request sent
+func setServerFields(event *Event, tenant string) {
+	event.Tenant = tenant
+	event.Hash = ""
+}
+
+func contains(intSlice []int, value int) bool {
+	for _, element := range intSlice {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
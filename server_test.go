@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -135,7 +136,7 @@ func TestPostRequest(t *testing.T) {
 	t.Run("Post request should call RegisterNewEvents, pass event list and return number of lines created", func(t *testing.T) {
 		eventList := []Event{validEvent1, validEvent2}
 		spy := &Spy{}
-		store = &StubEventStore{eventList, spy}
+		store = &StubEventStore{events: eventList, spy: spy}
 
 		request := newPostRequest(eventList)
 		response := httptest.NewRecorder()
@@ -153,7 +154,7 @@ func TestPostRequest(t *testing.T) {
 	t.Run("Post request should register only valid events", func(t *testing.T) {
 		eventList := []Event{validEvent1, invalidEvent1, validEvent2, validEvent3, invalidEvent2, invalidEvent3}
 		spy := &Spy{}
-		store = &StubEventStore{eventList, spy}
+		store = &StubEventStore{events: eventList, spy: spy}
 		clock = MockClock{}
 
 		request := newPostRequest(eventList)
@@ -161,7 +162,10 @@ func TestPostRequest(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		wantResponse := fmt.Sprintf("{\"%s\":%d}", lineNumberResponseKey, 3)
+		wantResponse := fmt.Sprintf("{\"%s\":%d,\"errors\":[%s,%s,%s]}", lineNumberResponseKey, 3,
+			`{"index":1,"errors":["data must be a json string"]}`,
+			`{"index":4,"errors":["flags must contain at least one value"]}`,
+			`{"index":5,"errors":["data must be a json string"]}`)
 
 		validEvent3.Timestamp = clock.Now()
 		wantlistGivenAsParameter := []Event{validEvent1, validEvent2, validEvent3}
@@ -177,7 +181,7 @@ func TestDeleteByIdRequest(t *testing.T) {
 	t.Run("Delete request should set event with given id to default values", func(t *testing.T) {
 		eventList := []Event{validEvent1, validEvent2, validEvent3}
 		spy := &Spy{}
-		store = &StubEventStore{eventList, spy}
+		store = &StubEventStore{events: eventList, spy: spy}
 
 		request := newDeleteRequest(api_url + "3")
 		response := httptest.NewRecorder()
@@ -195,7 +199,7 @@ func TestDeleteByIdRequest(t *testing.T) {
 	})
 
 	t.Run("Delete request should return 0 lines affected when no event with given id exists", func(t *testing.T) {
-		store = &StubEventStore{[]Event{}, &Spy{}}
+		store = &StubEventStore{events: []Event{}, spy: &Spy{}}
 
 		request := newDeleteRequest(api_url + "4")
 		response := httptest.NewRecorder()
@@ -209,7 +213,7 @@ func TestDeleteByIdRequest(t *testing.T) {
 	})
 
 	t.Run("Delete request should return status code 422 if parameter given is not a number", func(t *testing.T) {
-		store = &StubEventStore{[]Event{}, &Spy{}}
+		store = &StubEventStore{events: []Event{}, spy: &Spy{}}
 
 		request := newDeleteRequest(api_url + "tstnrst")
 		response := httptest.NewRecorder()
@@ -224,7 +228,7 @@ func TestDeleteByFlagRequest(t *testing.T) {
 	t.Run("Delete request should set events with given flag to default value", func(t *testing.T) {
 		eventList := []Event{validEvent1, validEvent2, validEvent3, validEvent4, validEvent5}
 		spy := &Spy{}
-		store = &StubEventStore{eventList, spy}
+		store = &StubEventStore{events: eventList, spy: spy}
 
 		request := newDeleteRequest(api_url + "deleteflag/5")
 		response := httptest.NewRecorder()
@@ -303,11 +307,161 @@ var invalidEvent3 = Event{
 type Spy struct {
 	calledFunction       string
 	listGivenAsParameter []Event
+	registeredBatches    [][]Event
 }
 
 type StubEventStore struct {
-	events []Event
-	spy    *Spy
+	events      []Event
+	spy         *Spy
+	flags       []Flag
+	collections []Collection
+	webhooks    []Webhook
+	deliveries  []Delivery
+	changes     []Change
+	apiKeys     []APIKey
+	audit       []AuditEntry
+	outbox      []stubOutboxRecord
+	outboxLock  sync.Mutex
+}
+
+type stubOutboxRecord struct {
+	record     OutboxRecord
+	dispatched bool
+}
+
+func (s *StubEventStore) ForTenant(tenant string) EventStore {
+	return &tenantStubEventStore{StubEventStore: s, tenant: tenant}
+}
+
+// tenantStubEventStore only sees and neutralizes the events of its tenant, as PostGreStore.ForTenant
+type tenantStubEventStore struct {
+	*StubEventStore
+	tenant string
+}
+
+func (s *tenantStubEventStore) GetEventById(id int) Event {
+	return s.filterOne(s.StubEventStore.GetEventById(id))
+}
+
+func (s *tenantStubEventStore) GetLastEventBefore(id int) (event Event) {
+	for _, value := range s.events {
+		if value.Id < id && value.Tenant == s.tenant {
+			event = value
+		}
+	}
+
+	return
+}
+
+func (s *tenantStubEventStore) GetAllEvents() []Event {
+	return s.filter(s.StubEventStore.GetAllEvents())
+}
+
+func (s *tenantStubEventStore) GetEventsByFlag(flag int) []Event {
+	return s.filter(s.StubEventStore.GetEventsByFlag(flag))
+}
+
+func (s *tenantStubEventStore) GetEventsBetween(from, to time.Time) []Event {
+	return s.filter(s.StubEventStore.GetEventsBetween(from, to))
+}
+
+func (s *tenantStubEventStore) GetFlagStats(from, to time.Time, excludedFlags []int) []FlagStats {
+	return computeFlagStats(s.GetEventsBetween(from, to), excludedFlags)
+}
+
+func (s *tenantStubEventStore) StreamAllEvents(yield func(Event) bool) {
+	s.StubEventStore.StreamAllEvents(s.filterYield(yield))
+}
+
+func (s *tenantStubEventStore) StreamEventsByFlag(flag int, yield func(Event) bool) {
+	s.StubEventStore.StreamEventsByFlag(flag, s.filterYield(yield))
+}
+
+func (s *tenantStubEventStore) StreamEventsAfterId(id int, yield func(Event) bool) {
+	s.StubEventStore.StreamEventsAfterId(id, s.filterYield(yield))
+}
+
+func (s *tenantStubEventStore) StreamEventsBetween(from, to time.Time, yield func(Event) bool) {
+	s.StubEventStore.StreamEventsBetween(from, to, s.filterYield(yield))
+}
+
+func (s *tenantStubEventStore) RegisterNewEvents(eventList []Event, outbox OutboxRecord) int {
+	var tenantEvents []Event
+	for _, event := range eventList {
+		event.Tenant = s.tenant
+		tenantEvents = append(tenantEvents, event)
+	}
+	return s.StubEventStore.RegisterNewEvents(tenantEvents, outbox)
+}
+
+func (s *tenantStubEventStore) DeleteById(id int) int {
+	s.spy.calledFunction = deleteByIdFunctionName
+
+	for i, event := range s.events {
+		if event.Id == id && event.Tenant == s.tenant {
+			s.neutralize(i)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (s *tenantStubEventStore) DeleteByFlag(flag int) int {
+	s.spy.calledFunction = deleteByFlagFunctionName
+	linesDeleted := 0
+
+	for i, event := range s.events {
+		if contains(event.Flags, flag) && event.Tenant == s.tenant {
+			s.neutralize(i)
+			linesDeleted++
+		}
+	}
+
+	return linesDeleted
+}
+
+func (s *tenantStubEventStore) GetChangesSince(sequence int64, limit int) (changeList []Change, lastSequence int64) {
+	lastSequence = sequence
+	for _, change := range s.changes {
+		if change.Sequence > sequence && change.Event.Tenant == s.tenant && len(changeList) < limit {
+			changeList = append(changeList, change)
+			lastSequence = change.Sequence
+		}
+	}
+
+	return
+}
+
+func (s *tenantStubEventStore) neutralize(i int) {
+	hash := s.events[i].Hash
+	s.events[i] = createNeutralEventWithId(s.events[i].Id)
+	s.events[i].Tenant, s.events[i].Hash = s.tenant, hash
+	s.recordChange(changeDeleted, s.events[i])
+}
+
+func (s *tenantStubEventStore) filterOne(event Event) Event {
+	if event.Tenant != s.tenant {
+		return Event{}
+	}
+
+	return event
+}
+
+func (s *tenantStubEventStore) filter(eventList []Event) (tenantEvents []Event) {
+	for _, event := range eventList {
+		if event.Tenant == s.tenant {
+			tenantEvents = append(tenantEvents, event)
+		}
+	}
+
+	return
+}
+
+func (s *tenantStubEventStore) filterYield(yield func(Event) bool) func(Event) bool {
+	return func(event Event) bool {
+		return event.Tenant != s.tenant || yield(event)
+	}
 }
 
 func (s *StubEventStore) GetEventById(id int) (event Event) {
@@ -321,6 +475,16 @@ func (s *StubEventStore) GetEventById(id int) (event Event) {
 	return
 }
 
+func (s *StubEventStore) GetLastEventBefore(id int) (event Event) {
+	for _, value := range s.events {
+		if value.Id < id {
+			event = value
+		}
+	}
+
+	return
+}
+
 func (s *StubEventStore) GetAllEvents() []Event {
 	return s.events
 }
@@ -335,27 +499,149 @@ func (s *StubEventStore) GetEventsByFlag(flag int) (eventList []Event) {
 	return
 }
 
-func contains(intSlice []int, value int) bool {
-	for _, element := range intSlice {
-		if element == value {
-			return true
+func (s *StubEventStore) GetEventsBetween(from, to time.Time) (eventList []Event) {
+	for _, event := range s.events {
+		if event.Timestamp.Before(from) || (!to.IsZero() && event.Timestamp.After(to)) {
+			continue
+		}
+		eventList = append(eventList, event)
+	}
+
+	return
+}
+
+func (s *StubEventStore) GetFlagStats(from, to time.Time, excludedFlags []int) []FlagStats {
+	return computeFlagStats(s.GetEventsBetween(from, to), excludedFlags)
+}
+
+func (s *StubEventStore) StreamAllEvents(yield func(Event) bool) {
+	for _, event := range s.events {
+		if !yield(event) {
+			return
 		}
 	}
-	return false
 }
 
-func (s *StubEventStore) RegisterNewEvents(eventList []Event) int {
+func (s *StubEventStore) StreamEventsByFlag(flag int, yield func(Event) bool) {
+	for _, event := range s.events {
+		if contains(event.Flags, flag) && !yield(event) {
+			return
+		}
+	}
+}
+
+func (s *StubEventStore) StreamEventsAfterId(id int, yield func(Event) bool) {
+	for _, event := range s.events {
+		if event.Id > id && !yield(event) {
+			return
+		}
+	}
+}
+
+func (s *StubEventStore) StreamEventsBetween(from, to time.Time, yield func(Event) bool) {
+	for _, event := range s.GetEventsBetween(from, to) {
+		if !yield(event) {
+			return
+		}
+	}
+}
+
+func (s *StubEventStore) RegisterNewEvents(eventList []Event, outbox OutboxRecord) int {
 	s.spy.calledFunction = registerFunctionName
 	s.spy.listGivenAsParameter = eventList
+	s.spy.registeredBatches = append(s.spy.registeredBatches, eventList)
+
+	storedEvents := s.appendChainedEvents(eventList)
+	for _, event := range storedEvents {
+		s.recordChange(changeCreated, event)
+	}
+
+	if len(eventList) > 0 {
+		s.outboxLock.Lock()
+		outbox.Id = len(s.outbox) + 1
+		outbox.Events = storedEvents
+		s.outbox = append(s.outbox, stubOutboxRecord{record: outbox})
+		s.outboxLock.Unlock()
+	}
+
 	return len(eventList)
 }
 
+// appendChainedEvents stores copies of the events with their ids and hashes, as PostGreStore
+func (s *StubEventStore) appendChainedEvents(eventList []Event) (storedEvents []Event) {
+	lastId, lastHashes := 0, map[string]string{}
+	for _, event := range s.events {
+		if event.Id > lastId {
+			lastId = event.Id
+		}
+		lastHashes[event.Tenant] = event.Hash
+	}
+
+	for _, event := range eventList {
+		lastId++
+		event.Id = lastId
+		chainedEvent := []Event{event}
+		chainEvents(lastHashes[event.Tenant], chainedEvent)
+
+		s.events = append(s.events, chainedEvent[0])
+		storedEvents = append(storedEvents, chainedEvent[0])
+		lastHashes[event.Tenant] = chainedEvent[0].Hash
+	}
+
+	return
+}
+
+func (s *StubEventStore) recordChange(changeType string, event Event) {
+	s.changes = append(s.changes, Change{Sequence: int64(len(s.changes) + 1), Type: changeType, Event: event})
+}
+
+func (s *StubEventStore) GetChangesSince(sequence int64, limit int) (changeList []Change, lastSequence int64) {
+	lastSequence = sequence
+	for _, change := range s.changes {
+		if change.Sequence > sequence && len(changeList) < limit {
+			changeList = append(changeList, change)
+			lastSequence = change.Sequence
+		}
+	}
+
+	return
+}
+
+func (s *StubEventStore) GetPendingOutboxRecords(limit int) (recordList []OutboxRecord) {
+	s.outboxLock.Lock()
+	defer s.outboxLock.Unlock()
+
+	for _, value := range s.outbox {
+		if !value.dispatched && len(recordList) < limit {
+			recordList = append(recordList, value.record)
+		}
+	}
+
+	return
+}
+
+func (s *StubEventStore) MarkOutboxRecordDispatched(id int) int {
+	s.outboxLock.Lock()
+	defer s.outboxLock.Unlock()
+
+	for i, value := range s.outbox {
+		if value.record.Id == id {
+			s.outbox[i].dispatched = true
+			return 1
+		}
+	}
+
+	return 0
+}
+
 func (s *StubEventStore) DeleteById(id int) int {
 	s.spy.calledFunction = deleteByIdFunctionName
 
 	for i, event := range s.events {
 		if event.Id == id {
 			s.events[i] = createNeutralEventWithId(id)
+			s.events[i].Hash = event.Hash
+			s.recordChange(changeDeleted, s.events[i])
 			return 1
 		}
 	}
@@ -370,6 +656,8 @@ func (s *StubEventStore) DeleteByFlag(flag int) int {
 	for i, event := range s.events {
 		if contains(event.Flags, flag) {
 			s.events[i] = createNeutralEventWithId(event.Id)
+			s.events[i].Hash = event.Hash
+			s.recordChange(changeDeleted, s.events[i])
 			linesDeleted++
 		}
 	}
@@ -377,6 +665,206 @@ func (s *StubEventStore) DeleteByFlag(flag int) int {
 	return linesDeleted
 }
 
+func (s *StubEventStore) GetFlagById(id int) (flag Flag) {
+	for _, value := range s.flags {
+		if value.Id == id {
+			flag = value
+			break
+		}
+	}
+
+	return
+}
+
+func (s *StubEventStore) GetFlagByName(name string) (flag Flag) {
+	for _, value := range s.flags {
+		if value.Name == name {
+			flag = value
+			break
+		}
+	}
+
+	return
+}
+
+func (s *StubEventStore) GetAllFlags() []Flag {
+	return s.flags
+}
+
+func (s *StubEventStore) RegisterFlag(flag Flag) int {
+	s.flags = append(s.flags, flag)
+	return 1
+}
+
+func (s *StubEventStore) UpdateFlag(flag Flag) int {
+	for i, value := range s.flags {
+		if value.Id == flag.Id {
+			s.flags[i] = flag
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (s *StubEventStore) DeleteFlag(id int) int {
+	for i, value := range s.flags {
+		if value.Id == id {
+			s.flags = append(s.flags[:i], s.flags[i+1:]...)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (s *StubEventStore) GetAllCollections() []Collection {
+	return s.collections
+}
+
+func (s *StubEventStore) RegisterCollection(collection Collection) int {
+	s.collections = append(s.collections, collection)
+	return 1
+}
+
+func (s *StubEventStore) DeleteCollection(name string) int {
+	for i, collection := range s.collections {
+		if collection.Name == name {
+			s.collections = append(s.collections[:i], s.collections[i+1:]...)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (s *StubEventStore) GetAllWebhooks() []Webhook {
+	webhookList := make([]Webhook, len(s.webhooks))
+	copy(webhookList, s.webhooks)
+	return webhookList
+}
+
+func (s *StubEventStore) GetWebhookById(id int) (webhook Webhook) {
+	for _, value := range s.webhooks {
+		if value.Id == id {
+			webhook = value
+			break
+		}
+	}
+
+	return
+}
+
+func (s *StubEventStore) RegisterWebhook(webhook Webhook) int {
+	webhook.Id = len(s.webhooks) + 1
+	s.webhooks = append(s.webhooks, webhook)
+	return webhook.Id
+}
+
+func (s *StubEventStore) DeleteWebhook(id int) int {
+	for i, webhook := range s.webhooks {
+		if webhook.Id == id {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (s *StubEventStore) RegisterDelivery(delivery Delivery) int {
+	delivery.Id = len(s.deliveries) + 1
+	s.deliveries = append(s.deliveries, delivery)
+	return delivery.Id
+}
+
+func (s *StubEventStore) GetPendingDeliveries(now time.Time, limit int) (deliveryList []Delivery) {
+	waitingWebhooks := map[int]bool{}
+
+	for _, delivery := range s.deliveries {
+		if delivery.Status != deliveryPending || waitingWebhooks[delivery.WebhookId] || len(deliveryList) == limit {
+			continue
+		}
+		if delivery.NextAttempt.After(now) {
+			waitingWebhooks[delivery.WebhookId] = true
+			continue
+		}
+		deliveryList = append(deliveryList, delivery)
+	}
+
+	return
+}
+
+func (s *StubEventStore) GetDeliveriesByWebhook(webhookId int) (deliveryList []Delivery) {
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookId == webhookId {
+			deliveryList = append(deliveryList, delivery)
+		}
+	}
+
+	return
+}
+
+func (s *StubEventStore) UpdateDelivery(delivery Delivery) int {
+	for i, value := range s.deliveries {
+		if value.Id == delivery.Id {
+			s.deliveries[i] = delivery
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (s *StubEventStore) GetAllAPIKeys() []APIKey {
+	return s.apiKeys
+}
+
+func (s *StubEventStore) GetAPIKeyByHash(hash string) (apiKey APIKey) {
+	for _, value := range s.apiKeys {
+		if value.Hash == hash {
+			apiKey = value
+			break
+		}
+	}
+
+	return
+}
+
+func (s *StubEventStore) RegisterAPIKey(apiKey APIKey) int {
+	apiKey.Id = len(s.apiKeys) + 1
+	s.apiKeys = append(s.apiKeys, apiKey)
+	return apiKey.Id
+}
+
+func (s *StubEventStore) RevokeAPIKey(id int, revokedAt time.Time) int {
+	for i, value := range s.apiKeys {
+		if value.Id == id && value.RevokedAt == nil {
+			s.apiKeys[i].RevokedAt = &revokedAt
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (s *StubEventStore) RegisterAuditedAction(entry AuditEntry, action func() int) (int, bool) {
+	entry.AffectedLines = action()
+	entry.Id = len(s.audit) + 1
+	s.audit = append(s.audit, entry)
+	return entry.AffectedLines, true
+}
+
+func (s *StubEventStore) GetAuditEntries(from, to time.Time) (entryList []AuditEntry) {
+	for _, entry := range s.audit {
+		if (from.IsZero() || !entry.Time.Before(from)) && (to.IsZero() || entry.Time.Before(to)) {
+			entryList = append(entryList, entry)
+		}
+	}
+
+	return
+}
+
 type MockClock struct{}
 
 func (m MockClock) Now() time.Time {
@@ -472,6 +960,29 @@ func getEventFromResponse(t *testing.T, body io.Reader) (event Event) {
 	return
 }
 
+func getEventListFromResponse(t *testing.T, body io.Reader) (eventList []Event) {
+	t.Helper()
+
+	err := json.NewDecoder(body).Decode(&eventList)
+
+	if err != nil {
+		t.Fatalf("unable to parse response from server %q into an Event list: %v", body, err)
+	}
+
+	return
+}
+
+// withoutIds gives copies of the events as sent by clients, the store assigning the ids
+func withoutIds(eventList ...Event) []Event {
+	copies := make([]Event, len(eventList))
+	for i, event := range eventList {
+		event.Id = 0
+		copies[i] = event
+	}
+
+	return copies
+}
+
 func createNeutralEventWithId(id int) Event {
 	return Event{
 		Id:        id,
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	sseContentType     = "text/event-stream"
+	lastEventIdHeader  = "Last-Event-ID"
+	sseEventName       = "event"
+	flagQueryParameter = "flag"
+)
+
+var sseKeepAliveInterval = 15 * time.Second
+
+// streamHandler sends registered events as Server-Sent Events. When the client resumes with
+// Last-Event-ID, the events stored after this id are replayed before the live ones.
+func streamHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	flags, err := getFlagsFromQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	lastEventId := 0
+	if value := r.Header.Get(lastEventIdHeader); value != "" {
+		if lastEventId, err = strconv.Atoi(value); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	s := broker.subscribe(mux.Vars(r)["controller"], getTenant(r), flags, getHiddenFlags(r))
+	defer broker.unsubscribe(s)
+
+	w.Header().Set("content-type", sseContentType)
+	w.Header().Set("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	if lastEventId > 0 {
+		eventStore.StreamEventsAfterId(lastEventId, func(event Event) bool {
+			if !s.matches(event) {
+				return true
+			}
+			lastEventId = event.Id
+			return writeServerSentEvent(w, event) == nil
+		})
+		flush(w)
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flush(w)
+
+		case event, ok := <-s.events:
+			if !ok {
+				return
+			}
+			// Already sent while replaying from the store, live events carrying the ids assigned by the store
+			if event.Id <= lastEventId {
+				continue
+			}
+			if writeServerSentEvent(w, event) != nil {
+				return
+			}
+			flush(w)
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, event Event) error {
+	eventAsJson, _ := json.Marshal(&event)
+
+	if event.Id != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.Id); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", sseEventName, eventAsJson)
+	return err
+}
+
+func getFlagsFromQuery(r *http.Request) (flags []int, err error) {
+	for _, value := range r.URL.Query()[flagQueryParameter] {
+		flag, err := parseFlag(value)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+
+	return
+}
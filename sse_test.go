@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamRequestWithServerSentEvents(t *testing.T) {
+	t.Run("Stream should send newly posted events carrying the requested flag", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		testServer := httptest.NewServer(server)
+		defer testServer.Close()
+
+		reader, cancel := openEventStream(t, testServer.URL+api_url+"stream?flag=5", "")
+		defer cancel()
+
+		postEvents(t, testServer.URL+api_url, withoutIds(validEvent1, validEvent2))
+
+		id, event := readServerSentEvent(t, reader)
+
+		assertResponseBody(t, id, "2")
+		assertEvent(t, event, stub.events[1])
+	})
+
+	t.Run("Stream should replay stored events after Last-Event-ID before live ones", func(t *testing.T) {
+		stub := &StubEventStore{events: []Event{validEvent1, validEvent2, validEvent4, validEvent5}, spy: &Spy{}}
+		store = stub
+		testServer := httptest.NewServer(server)
+		defer testServer.Close()
+
+		reader, cancel := openEventStream(t, testServer.URL+api_url+"stream", "2")
+		defer cancel()
+
+		_, event := readServerSentEvent(t, reader)
+		assertEvent(t, event, validEvent4)
+
+		_, event = readServerSentEvent(t, reader)
+		assertEvent(t, event, validEvent5)
+
+		newEvent := Event{Id: 1, Timestamp: validEvent1.Timestamp, Flags: []int{1}, Data: "{}"}
+		postEvents(t, testServer.URL+api_url, []Event{newEvent})
+
+		id, event := readServerSentEvent(t, reader)
+		assertResponseBody(t, id, "6")
+		assertEvent(t, event, stub.events[4])
+	})
+
+	t.Run("Stream should only send events of its collection", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		useCollectionStores(t, map[string]EventStore{"telemetry": &StubEventStore{spy: &Spy{}}})
+		testServer := httptest.NewServer(server)
+		defer testServer.Close()
+
+		reader, cancel := openEventStream(t, testServer.URL+api_url+"stream", "")
+		defer cancel()
+
+		postEvents(t, testServer.URL+"/api/telemetry/", withoutIds(validEvent1))
+		postEvents(t, testServer.URL+api_url, withoutIds(validEvent2))
+
+		_, event := readServerSentEvent(t, reader)
+		assertEvent(t, event, stub.events[0])
+	})
+
+	t.Run("Stream request should return status code 422 when flag is unknown", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		request := newGetRequest(api_url + "stream?flag=unknown")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	b := newEventBroker()
+	s := b.subscribe(defaultController, "", nil, nil)
+
+	for i := 0; i <= subscriptionBufferSize; i++ {
+		b.publish(defaultController, []Event{validEvent1})
+	}
+
+	received := 0
+	for range s.events {
+		received++
+	}
+
+	if received != subscriptionBufferSize {
+		t.Errorf("slow subscriber should be closed after %d events, got %d", subscriptionBufferSize, received)
+	}
+
+	b.unsubscribe(s)
+}
+
+// Helpers
+func openEventStream(t *testing.T, url, lastEventId string) (*bufio.Reader, context.CancelFunc) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventId != "" {
+		request.Header.Set(lastEventIdHeader, lastEventId)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		cancel()
+		t.Fatalf("unable to open event stream: %v", err)
+	}
+
+	assertStatus(t, response.StatusCode, http.StatusOK)
+
+	return bufio.NewReader(response.Body), func() {
+		cancel()
+		response.Body.Close()
+	}
+}
+
+func postEvents(t *testing.T, url string, eventList []Event) {
+	t.Helper()
+
+	body, _ := json.Marshal(eventList)
+
+	response, err := http.Post(url, jsonContentType, strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("unable to post events: %v", err)
+	}
+	response.Body.Close()
+
+	relayOutbox()
+}
+
+func readServerSentEvent(t *testing.T, reader *bufio.Reader) (id string, event Event) {
+	t.Helper()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimSuffix(line, "\n")
+			if line == "\n" {
+				return
+			}
+		}
+	}()
+
+	timeout := time.After(2 * time.Second)
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("event stream closed")
+			}
+			if strings.HasPrefix(line, "id: ") {
+				id = strings.TrimPrefix(line, "id: ")
+			}
+			if strings.HasPrefix(line, "data: ") {
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+			}
+			if line == "" && event.Id != 0 {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no event received")
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+type FlagStats struct {
+	Flag  int       `json:"flag"`
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+func flagStatsHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	from, to, err := getTimeRangeFromRequest(r)
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		flagStats := eventStore.GetFlagStats(from, to, nil)
+		if flagStats == nil {
+			flagStats = []FlagStats{}
+		}
+
+		w.Header().Set("content-type", jsonContentType)
+		writeResponseBody(w, &flagStats)
+	}
+}
+
+// computeFlagStats aggregates a list of events as stores do in their query, for the stores
+// which cannot aggregate themselves
+func computeFlagStats(eventList []Event, excludedFlags []int) []FlagStats {
+	statsByFlag := map[int]*FlagStats{}
+
+	for _, event := range eventList {
+		if isNeutralEvent(event) || isHiddenEvent(event, excludedFlags) {
+			continue
+		}
+
+		for _, flag := range event.Flags {
+			stats, ok := statsByFlag[flag]
+			if !ok {
+				stats = &FlagStats{Flag: flag, First: event.Timestamp, Last: event.Timestamp}
+				statsByFlag[flag] = stats
+			}
+
+			stats.Count++
+			if event.Timestamp.Before(stats.First) {
+				stats.First = event.Timestamp
+			}
+			if event.Timestamp.After(stats.Last) {
+				stats.Last = event.Timestamp
+			}
+		}
+	}
+
+	flagStats := make([]FlagStats, 0, len(statsByFlag))
+	for _, stats := range statsByFlag {
+		flagStats = append(flagStats, *stats)
+	}
+
+	sort.Slice(flagStats, func(i, j int) bool {
+		return flagStats[i].Flag < flagStats[j].Flag
+	})
+
+	return flagStats
+}
+
+// isNeutralEvent only accepts the exact values of a neutralization, clients being unable to send
+// the neutral flag: an event altered into one of them still has its hash checked
+func isNeutralEvent(event Event) bool {
+	return reflect.DeepEqual(event.Flags, neutralFlagsValue) &&
+		event.Timestamp.Equal(neutralTimestampValue) &&
+		event.Data == neutralDataValue
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFlagStatsRequest(t *testing.T) {
+	store = &StubEventStore{events: timerEvents}
+
+	t.Run("Flag stats request should return count, first and last timestamps for each flag", func(t *testing.T) {
+		request := newGetRequest(api_url + "stats/flags")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := []FlagStats{
+			{Flag: 1, Count: 4, First: timerEvents[0].Timestamp, Last: timerEvents[4].Timestamp},
+			{Flag: 2, Count: 2, First: timerEvents[2].Timestamp, Last: timerEvents[3].Timestamp},
+		}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+		assertFlagStats(t, getFlagStatsFromResponse(t, response), want)
+	})
+
+	t.Run("Flag stats request should only count events within the given time range", func(t *testing.T) {
+		request := newGetRequest(api_url + "stats/flags?from=2020-11-13T21:00:00Z&to=2020-11-14T08:30:00Z")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := []FlagStats{
+			{Flag: 1, Count: 1, First: timerEvents[1].Timestamp, Last: timerEvents[1].Timestamp},
+			{Flag: 2, Count: 1, First: timerEvents[2].Timestamp, Last: timerEvents[2].Timestamp},
+		}
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFlagStats(t, getFlagStatsFromResponse(t, response), want)
+	})
+
+	t.Run("Flag stats request should return an empty list when no event matches", func(t *testing.T) {
+		request := newGetRequest(api_url + "stats/flags?from=2021-01-01T00:00:00Z")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFlagStats(t, getFlagStatsFromResponse(t, response), []FlagStats{})
+	})
+
+	t.Run("Flag stats request should return status code 422 when time range is invalid", func(t *testing.T) {
+		request := newGetRequest(api_url + "stats/flags?to=tomorrow")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("Flag stats request should return the stats aggregated by the store", func(t *testing.T) {
+		want := []FlagStats{{Flag: 7, Count: 1200, First: timerEvents[0].Timestamp, Last: timerEvents[4].Timestamp}}
+		store = aggregatingEventStore{StubEventStore: &StubEventStore{}, flagStats: want}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest(api_url+"stats/flags"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFlagStats(t, getFlagStatsFromResponse(t, response), want)
+	})
+}
+
+func TestFlagStatsWithRestrictedFlags(t *testing.T) {
+	store = &StubEventStore{events: []Event{validEvent1, antiCheatEvent}, flags: []Flag{antiCheatFlag}, apiKeys: roleAPIKeys()}
+	useAuthentication(t, "")
+
+	t.Run("Flag stats request should not count the events hidden from the role", func(t *testing.T) {
+		response := serveWithAPIKey(newGetRequest(api_url+"stats/flags"), "client-key")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFlagStats(t, getFlagStatsFromResponse(t, response), computeFlagStats([]Event{validEvent1}, nil))
+	})
+
+	t.Run("Flag stats request should count the restricted events for the allowed roles", func(t *testing.T) {
+		response := serveWithAPIKey(newGetRequest(api_url+"stats/flags"), "staff-key")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertFlagStats(t, getFlagStatsFromResponse(t, response), computeFlagStats([]Event{validEvent1, antiCheatEvent}, nil))
+	})
+}
+
+// Test doubles
+// aggregatingEventStore answers stats queries without holding any event, as a database would
+type aggregatingEventStore struct {
+	*StubEventStore
+	flagStats []FlagStats
+}
+
+func (s aggregatingEventStore) ForTenant(tenant string) EventStore {
+	return s
+}
+
+func (s aggregatingEventStore) GetFlagStats(from, to time.Time, excludedFlags []int) []FlagStats {
+	return s.flagStats
+}
+
+// Helpers
+func assertFlagStats(t *testing.T, got, want []FlagStats) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("flag stats are different:\ngot %+v\nwant %+v", got, want)
+	}
+
+	for i := range got {
+		if got[i].Flag != want[i].Flag || got[i].Count != want[i].Count || !got[i].First.Equal(want[i].First) || !got[i].Last.Equal(want[i].Last) {
+			t.Errorf("flag stats are different:\ngot %+v\nwant %+v", got, want)
+		}
+	}
+}
+
+func getFlagStatsFromResponse(t *testing.T, response *httptest.ResponseRecorder) (flagStats []FlagStats) {
+	t.Helper()
+
+	err := json.NewDecoder(response.Body).Decode(&flagStats)
+
+	if err != nil {
+		t.Fatalf("unable to parse response from server %q into flag stats: %v", response.Body, err)
+	}
+
+	return
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	streamParameter     = "stream"
+	streamFlushInterval = 100
+)
+
+type eventIterator func(yield func(Event) bool)
+
+func isStreamRequested(r *http.Request) bool {
+	stream, _ := strconv.ParseBool(r.URL.Query().Get(streamParameter))
+	return stream || accepts(r, ndjsonContentType) || accepts(r, csvContentType)
+}
+
+// streamEvents writes events as they are produced by the store, as CSV rows or one per line
+// when NDJSON is accepted or as a single JSON array, so memory does not grow with the result size
+func streamEvents(w http.ResponseWriter, r *http.Request, iterate eventIterator) {
+	if accepts(r, csvContentType) {
+		w.Header().Set("content-type", csvContentType)
+		streamCSV(w, iterate)
+	} else if accepts(r, ndjsonContentType) {
+		w.Header().Set("content-type", ndjsonContentType)
+		streamNDJSON(w, iterate)
+	} else {
+		w.Header().Set("content-type", jsonContentType)
+		streamJSONArray(w, iterate)
+	}
+}
+
+func streamNDJSON(w http.ResponseWriter, iterate eventIterator) {
+	encoder := json.NewEncoder(w)
+	written := 0
+
+	iterate(func(event Event) bool {
+		if encoder.Encode(&event) != nil {
+			return false
+		}
+
+		written++
+		flushEvery(w, written)
+		return true
+	})
+
+	flush(w)
+}
+
+func streamJSONArray(w http.ResponseWriter, iterate eventIterator) {
+	if _, err := w.Write([]byte("[")); err != nil {
+		return
+	}
+
+	written := 0
+
+	iterate(func(event Event) bool {
+		eventAsJson, _ := json.Marshal(&event)
+
+		if written > 0 {
+			eventAsJson = append([]byte(","), eventAsJson...)
+		}
+		if _, err := w.Write(eventAsJson); err != nil {
+			return false
+		}
+
+		written++
+		flushEvery(w, written)
+		return true
+	})
+
+	_, _ = w.Write([]byte("]\n"))
+	flush(w)
+}
+
+func flushEvery(w http.ResponseWriter, written int) {
+	if written%streamFlushInterval == 0 {
+		flush(w)
+	}
+}
+
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamRequest(t *testing.T) {
+	eventList := []Event{validEvent1, validEvent2, validEvent4, validEvent5}
+	store = &StubEventStore{events: eventList}
+
+	t.Run("Get request should stream all events as NDJSON when accepted", func(t *testing.T) {
+		request := newGetRequest(api_url)
+		request.Header.Set("accept", ndjsonContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := strings.Join([]string{toJsonLine(validEvent1), toJsonLine(validEvent2), toJsonLine(validEvent4), toJsonLine(validEvent5)}, "\n") + "\n"
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, ndjsonContentType)
+		assertResponseBody(t, response.Body.String(), want)
+	})
+
+	t.Run("Get request should stream all events as a JSON array when requested", func(t *testing.T) {
+		request := newGetRequest(api_url + "?stream=true")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		eventListAsJson, _ := json.Marshal(eventList)
+		want := string(eventListAsJson) + "\n"
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+		assertResponseBody(t, response.Body.String(), want)
+	})
+
+	t.Run("Get request should stream events with given flag", func(t *testing.T) {
+		request := newGetRequest(api_url + "getFlag/5")
+		request.Header.Set("accept", "application/json, "+ndjsonContentType+";q=0.9")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		want := toJsonLine(validEvent2) + "\n" + toJsonLine(validEvent5) + "\n"
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), want)
+	})
+
+	t.Run("Get request should return an empty array when streaming no event", func(t *testing.T) {
+		request := newGetRequest(api_url + "getFlag/42?stream=1")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "[]\n")
+	})
+}
+
+func TestStreamStopsWhenClientIsGone(t *testing.T) {
+	yielded := 0
+	iterate := func(yield func(Event) bool) {
+		for _, event := range []Event{validEvent1, validEvent2, validEvent4} {
+			yielded++
+			if !yield(event) {
+				return
+			}
+		}
+	}
+
+	streamNDJSON(&failingResponseWriter{httptest.NewRecorder()}, iterate)
+
+	if yielded != 1 {
+		t.Errorf("iteration should stop at the first failed write, got %d events yielded", yielded)
+	}
+}
+
+// Test doubles
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (f *failingResponseWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection closed")
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var racerEvent = Event{Id: 1, Timestamp: validEvent1.Timestamp, Flags: []int{7}, Data: `{"lap": 1}`, Tenant: "racer"}
+var puzzleEvent = Event{Id: 2, Timestamp: validEvent1.Timestamp, Flags: []int{7}, Data: `{"level": 3}`, Tenant: "puzzle"}
+
+func TestTenantIsolation(t *testing.T) {
+	t.Run("Get requests should only return the events of the principal's tenant", func(t *testing.T) {
+		store = &StubEventStore{events: []Event{racerEvent, puzzleEvent}, apiKeys: tenantAPIKeys()}
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newGetRequest(api_url), "racer-key")
+		assertEventList(t, getEventListFromResponse(t, response.Body), []Event{racerEvent})
+
+		response = serveWithAPIKey(newGetRequest(api_url+"getFlag/7"), "puzzle-key")
+		assertEventList(t, getEventListFromResponse(t, response.Body), []Event{puzzleEvent})
+
+		response = serveWithAPIKey(newGetRequest(api_url+"2"), "racer-key")
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("Delete requests should never neutralize the events of another tenant", func(t *testing.T) {
+		stub := &StubEventStore{events: []Event{racerEvent, puzzleEvent}, spy: &Spy{}, apiKeys: tenantAPIKeys()}
+		store = stub
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newDeleteRequest(api_url+"2"), "racer-key")
+		assertResponseBody(t, response.Body.String(), "{\"affectedlines\":0}")
+
+		response = serveWithAPIKey(newDeleteRequest(api_url+"deleteflag/7"), "racer-key")
+		assertResponseBody(t, response.Body.String(), "{\"affectedlines\":1}")
+
+		neutralizedEvent := createNeutralEventWithId(1)
+		neutralizedEvent.Tenant = "racer"
+		assertEventList(t, stub.events, []Event{neutralizedEvent, puzzleEvent})
+	})
+
+	t.Run("Post request should register events in the principal's tenant whatever their tenant field", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}, apiKeys: tenantAPIKeys()}
+		store = stub
+		useAuthentication(t, "")
+
+		event := validEvent1
+		event.Tenant = "puzzle"
+
+		serveWithAPIKey(newPostRequestTo(api_url, []Event{event}), "racer-key")
+
+		event.Tenant = "racer"
+		assertEventList(t, stub.spy.listGivenAsParameter, []Event{event})
+		assertEventList(t, stub.outbox[0].record.Events, stub.events)
+	})
+
+	t.Run("Post requests should ignore the hash and tenant sent by the client", func(t *testing.T) {
+		forgedEvent := validEvent1
+		forgedEvent.Tenant = "puzzle"
+		forgedEvent.Hash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+		want := validEvent1
+		want.Tenant = "racer"
+
+		for _, request := range []*http.Request{
+			newPostRequestTo(api_url, []Event{forgedEvent}),
+			newNDJSONPostRequest(api_url, toJsonLine(forgedEvent)+"\n"),
+		} {
+			stub := &StubEventStore{spy: &Spy{}, apiKeys: tenantAPIKeys()}
+			store = stub
+			useAuthentication(t, "")
+
+			serveWithAPIKey(request, "racer-key")
+
+			assertEventList(t, stub.spy.listGivenAsParameter, []Event{want})
+			if stub.events[0].Hash != computeEventHash("", stub.events[0]) {
+				t.Errorf("stored hash should be computed by the store, got %q", stub.events[0].Hash)
+			}
+		}
+	})
+
+	t.Run("Changes request should only return the changes of the principal's tenant", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}, apiKeys: tenantAPIKeys()}
+		store = stub
+		useAuthentication(t, "")
+
+		serveWithAPIKey(newPostRequestTo(api_url, withoutIds(validEvent1)), "racer-key")
+		serveWithAPIKey(newPostRequestTo(api_url, withoutIds(validEvent2)), "puzzle-key")
+
+		response := serveWithAPIKey(newGetRequest(api_url+"changes"), "puzzle-key")
+
+		assertChanges(t, getChangesFromResponse(t, response), []Change{{Sequence: 2, Type: changeCreated, Event: stub.events[1]}})
+	})
+
+	t.Run("Subscriptions should only receive the events of their tenant", func(t *testing.T) {
+		s := &subscription{tenant: "racer"}
+
+		if !s.matches(racerEvent) || s.matches(puzzleEvent) {
+			t.Errorf("subscription should only match events of its tenant")
+		}
+	})
+
+	t.Run("Webhooks should only be notified of the events of their tenant", func(t *testing.T) {
+		clock = MockClock{}
+		stub := &StubEventStore{webhooks: []Webhook{
+			{Id: 1, Collection: defaultController, Tenant: "racer", Url: "https://racer.local", Secret: "s3cr3t"},
+			{Id: 2, Collection: defaultController, Tenant: "puzzle", Url: "https://puzzle.local", Secret: "s3cr3t"},
+		}}
+		store = stub
+
+		notifyCreatedEvents(defaultController, []Event{racerEvent})
+		notifyDeletedEvent(defaultController, puzzleEvent)
+		notifyDeletedFlag(defaultController, "racer", 7, 1)
+
+		var webhookIds []int
+		for _, delivery := range stub.deliveries {
+			webhookIds = append(webhookIds, delivery.WebhookId)
+		}
+		if !reflect.DeepEqual(webhookIds, []int{1, 2, 1}) {
+			t.Errorf("incorrect notified webhooks %v", webhookIds)
+		}
+	})
+
+	t.Run("Webhook administration should be restricted to the principal's tenant", func(t *testing.T) {
+		stub := &StubEventStore{apiKeys: tenantAdminAPIKeys(), webhooks: []Webhook{{Id: 1, Collection: defaultController, Tenant: "racer", Url: "https://racer.local", Secret: "s3cr3t"}}}
+		store = stub
+		useAuthentication(t, "")
+
+		response := serveWithAPIKey(newGetRequest(webhooks_url), "puzzle-key")
+		assertResponseBody(t, response.Body.String(), "[]\n")
+
+		response = serveWithAPIKey(newGetRequest(webhooks_url+"1"), "puzzle-key")
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		response = serveWithAPIKey(newGetRequest(webhooks_url+"1/deliveries"), "puzzle-key")
+		assertStatus(t, response.Code, http.StatusNotFound)
+
+		response = serveWithAPIKey(newDeleteRequest(webhooks_url+"1"), "puzzle-key")
+		assertResponseBody(t, response.Body.String(), "{\"affectedlines\":0}")
+
+		serveWithAPIKey(newRequestWithBody(http.MethodPost, webhooks_url, Webhook{Url: "https://puzzle.local", Secret: "s3cr3t"}), "puzzle-key")
+		if len(stub.webhooks) != 2 || stub.webhooks[1].Tenant != "puzzle" {
+			t.Errorf("webhook should be registered in the principal's tenant, got %+v", stub.webhooks)
+		}
+	})
+
+	t.Run("API keys should be created in the admin's tenant unless by the bootstrap key", func(t *testing.T) {
+		stub := &StubEventStore{apiKeys: tenantAdminAPIKeys()}
+		store = stub
+		useAuthentication(t, "bootstrap-key")
+
+		serveWithAPIKey(newRequestWithBody(http.MethodPost, apikeys_url, APIKey{Name: "intruder", Roles: []string{adminRole}, Tenant: "racer"}), "puzzle-key")
+		serveWithAPIKey(newRequestWithBody(http.MethodPost, apikeys_url, APIKey{Name: "racer-server", Roles: []string{clientRole}, Tenant: "racer"}), "bootstrap-key")
+
+		if stub.apiKeys[2].Tenant != "puzzle" || stub.apiKeys[3].Tenant != "racer" {
+			t.Errorf("incorrect tenants %q and %q", stub.apiKeys[2].Tenant, stub.apiKeys[3].Tenant)
+		}
+
+		response := serveWithAPIKey(newDeleteRequest(apikeys_url+"1"), "puzzle-key")
+		assertResponseBody(t, response.Body.String(), "{\"affectedlines\":0}")
+
+		response = serveWithAPIKey(newGetRequest(apikeys_url), "puzzle-key")
+		var apiKeyList []APIKey
+		_ = json.NewDecoder(response.Body).Decode(&apiKeyList)
+		if len(apiKeyList) != 2 {
+			t.Errorf("puzzle admin should only list its 2 keys, got %+v", apiKeyList)
+		}
+	})
+
+	t.Run("Audit log should only list the entries of the admin's tenant unless read by the bootstrap key", func(t *testing.T) {
+		stub := &StubEventStore{apiKeys: tenantAdminAPIKeys()}
+		store = stub
+		useAuthentication(t, "bootstrap-key")
+
+		serveWithAPIKey(newRequestWithBody(http.MethodPost, webhooks_url, Webhook{Url: "https://puzzle.local", Secret: "s3cr3t"}), "puzzle-key")
+		serveWithAPIKey(newRequestWithBody(http.MethodPost, webhooks_url, Webhook{Url: "https://racer.local", Secret: "s3cr3t"}), "racer-key")
+
+		for key, want := range map[string][]AuditEntry{"racer-key": {stub.audit[1]}, "puzzle-key": {stub.audit[0]}, "bootstrap-key": stub.audit} {
+			response := serveWithAPIKey(newGetRequest(audit_url), key)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertAuditEntries(t, getAuditEntriesFromResponse(t, response.Body), want)
+		}
+	})
+
+	t.Run("Flag catalog and collections should only be administered by the bootstrap key", func(t *testing.T) {
+		stub := &StubEventStore{apiKeys: tenantAdminAPIKeys(), flags: []Flag{{Id: 1, Name: "kill"}}}
+		store = stub
+		useAuthentication(t, "bootstrap-key")
+
+		for _, request := range []*http.Request{
+			newRequestWithBody(http.MethodPost, flags_url, Flag{Name: "frag"}),
+			newRequestWithBody(http.MethodPut, flags_url+"1", Flag{Name: "frag", ReadRoles: []string{adminRole}}),
+			newDeleteRequest(flags_url + "1"),
+			newGetRequest(collections_url),
+			newRequestWithBody(http.MethodPost, collections_url, Collection{Name: "telemetry"}),
+			newDeleteRequest(collections_url + defaultController),
+		} {
+			response := serveWithAPIKey(request, "puzzle-key")
+			assertStatus(t, response.Code, http.StatusForbidden)
+		}
+		if len(stub.flags) != 1 || stub.flags[0].Name != "kill" {
+			t.Errorf("flag catalog should be untouched, got %+v", stub.flags)
+		}
+
+		response := serveWithAPIKey(newGetRequest(collections_url), "bootstrap-key")
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("Bearer tokens should give their tenant claim to the principal", func(t *testing.T) {
+		clock = MockClock{}
+		useJWTKeySet(t)
+
+		token := signToken(t, jwt.SigningMethodHS256, "hmac", testHMACSecret, jwt.MapClaims{"exp": jwt.NewNumericDate(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)), "tenant": "racer"})
+		principal, ok := authenticateBearerToken(token)
+
+		if !ok || principal.Tenant != "racer" {
+			t.Errorf("incorrect principal %+v", principal)
+		}
+	})
+}
+
+func TestTenantEventEncoding(t *testing.T) {
+	codec := protobufCodec{}
+
+	encoded, err := codec.encodeEventList([]Event{racerEvent})
+	assertNoError(t, err)
+
+	decoded, err := codec.decodeEventList(encoded)
+	assertNoError(t, err)
+	assertEventList(t, decoded, []Event{racerEvent})
+}
+
+// Helpers
+func tenantAPIKeys() []APIKey {
+	return []APIKey{
+		{Id: 1, Name: "racer", Roles: []string{staffRole}, Tenant: "racer", Hash: hashAPIKey("racer-key")},
+		{Id: 2, Name: "puzzle", Roles: []string{staffRole}, Tenant: "puzzle", Hash: hashAPIKey("puzzle-key")},
+	}
+}
+
+func tenantAdminAPIKeys() []APIKey {
+	return []APIKey{
+		{Id: 1, Name: "racer", Roles: []string{adminRole}, Tenant: "racer", Hash: hashAPIKey("racer-key")},
+		{Id: 2, Name: "puzzle", Roles: []string{adminRole}, Tenant: "puzzle", Hash: hashAPIKey("puzzle-key")},
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	certificateReloadInterval = 10 * time.Second
+	tlsClientRoles            = []string{clientRole}
+)
+
+// certificateReloader serves the certificate of certFile and keyFile, reloading it when
+// either file changes so that renewed certificates are used without restarting
+type certificateReloader struct {
+	sync.RWMutex
+	certFile    string
+	keyFile     string
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (c *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.certificate, nil
+}
+
+// reloadIfModified keeps the current certificate when the new files cannot be loaded,
+// for instance when only one of them has been written yet
+func (c *certificateReloader) reloadIfModified() {
+	modTime, err := c.getModTime()
+	if err != nil {
+		log.Println("unable to check TLS certificate:", err)
+		return
+	}
+
+	c.RLock()
+	modified := modTime.After(c.modTime)
+	c.RUnlock()
+
+	if modified {
+		if err := c.reload(); err != nil {
+			log.Println("unable to reload TLS certificate:", err)
+		}
+	}
+}
+
+func (c *certificateReloader) reload() error {
+	modTime, err := c.getModTime()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.certificate = &certificate
+	c.modTime = modTime
+	return nil
+}
+
+// getModTime returns the latest modification time of both files
+func (c *certificateReloader) getModTime() (modTime time.Time, err error) {
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTime, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	return
+}
+
+func (c *certificateReloader) watch() {
+	ticker := time.NewTicker(certificateReloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.reloadIfModified()
+	}
+}
+
+// checkTLSSettings refuses incomplete settings at startup rather than serving without the TLS
+// or client certificates they were meant to enable
+func checkTLSSettings(certFile, keyFile, clientCAFile string, requireClientCert bool, clientRoles []string) error {
+	switch {
+	case (certFile == "") != (keyFile == ""):
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	case certFile == "" && clientCAFile != "":
+		return errors.New("TLS_CLIENT_CA_FILE needs TLS_CERT_FILE and TLS_KEY_FILE")
+	case clientCAFile == "" && requireClientCert:
+		return errors.New("TLS_REQUIRE_CLIENT_CERT needs TLS_CLIENT_CA_FILE")
+	case clientCAFile == "" && len(clientRoles) > 0:
+		return errors.New("TLS_CLIENT_ROLES needs TLS_CLIENT_CA_FILE")
+	}
+
+	return nil
+}
+
+// newTLSConfig verifies client certificates against the CAs of clientCAFile when given:
+// always if requireClientCert, otherwise only when the client sends one
+func newTLSConfig(reloader *certificateReloader, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	content, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(content) {
+		return nil, errors.New("no certificate found in " + clientCAFile)
+	}
+
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// authenticateClientCertificate accepts verified client certificates, named by their common name
+func authenticateClientCertificate(r *http.Request) (Principal, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return Principal{}, false
+	}
+
+	certificate := r.TLS.VerifiedChains[0][0]
+	return Principal{Subject: certificate.Subject.CommonName, Roles: tlsClientRoles}, true
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertificateReloader(t *testing.T) {
+	t.Run("Reloader should serve the new certificate once its files change", func(t *testing.T) {
+		dir := t.TempDir()
+		ca := newTestCertificateAuthority(t)
+		certFile, keyFile := ca.writeCertificate(t, dir, "server", "first.local", x509.ExtKeyUsageServerAuth)
+
+		reloader, err := newCertificateReloader(certFile, keyFile)
+		assertNoError(t, err)
+		assertCertificateName(t, reloader, "first.local")
+
+		ca.writeCertificate(t, dir, "server", "second.local", x509.ExtKeyUsageServerAuth)
+		touchFiles(t, time.Now().Add(time.Minute), certFile, keyFile)
+		reloader.reloadIfModified()
+
+		assertCertificateName(t, reloader, "second.local")
+	})
+
+	t.Run("Reloader should keep the current certificate when the new files are invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		ca := newTestCertificateAuthority(t)
+		certFile, keyFile := ca.writeCertificate(t, dir, "server", "first.local", x509.ExtKeyUsageServerAuth)
+
+		reloader, err := newCertificateReloader(certFile, keyFile)
+		assertNoError(t, err)
+
+		assertNoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0600))
+		touchFiles(t, time.Now().Add(time.Minute), certFile)
+		reloader.reloadIfModified()
+
+		assertCertificateName(t, reloader, "first.local")
+	})
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificateAuthority(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	assertNoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw}), 0600))
+
+	serverCertFile, serverKeyFile := ca.writeCertificate(t, dir, "server", "127.0.0.1", x509.ExtKeyUsageServerAuth)
+	clientCertFile, clientKeyFile := ca.writeCertificate(t, dir, "client", "ingest-server", x509.ExtKeyUsageClientAuth)
+
+	reloader, err := newCertificateReloader(serverCertFile, serverKeyFile)
+	assertNoError(t, err)
+
+	clientCertificate, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	assertNoError(t, err)
+
+	startServer := func(t *testing.T, requireClientCert bool) string {
+		tlsConfig, err := newTLSConfig(reloader, caFile, requireClientCert)
+		assertNoError(t, err)
+
+		testServer := httptest.NewUnstartedServer(server)
+		testServer.Listener = tls.NewListener(testServer.Listener, tlsConfig)
+		testServer.Start()
+		t.Cleanup(testServer.Close)
+
+		return "https://" + testServer.Listener.Addr().String()
+	}
+
+	newClient := func(certificates ...tls.Certificate) *http.Client {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.certificate)
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates}}}
+	}
+
+	t.Run("Verified client certificate should authenticate the request with the client roles", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		useAuthentication(t, "")
+		serverURL := startServer(t, true)
+
+		response, err := newClient(clientCertificate).Post(serverURL+api_url, jsonContentType, newRequestWithBody(http.MethodPost, api_url, []Event{validEvent1}).Body)
+		assertNoError(t, err)
+		response.Body.Close()
+
+		assertStatus(t, response.StatusCode, http.StatusOK)
+		assertEventList(t, stub.spy.listGivenAsParameter, []Event{validEvent1})
+	})
+
+	t.Run("Handshake should fail without client certificate when one is required", func(t *testing.T) {
+		store = &StubEventStore{}
+		serverURL := startServer(t, true)
+
+		if _, err := newClient().Get(serverURL + api_url); err == nil {
+			t.Errorf("expected the handshake to fail")
+		}
+	})
+
+	t.Run("Request without client certificate should need other credentials when the certificate is optional", func(t *testing.T) {
+		store = &StubEventStore{}
+		useAuthentication(t, "")
+		serverURL := startServer(t, false)
+
+		response, err := newClient().Get(serverURL + api_url)
+		assertNoError(t, err)
+		response.Body.Close()
+
+		assertStatus(t, response.StatusCode, http.StatusUnauthorized)
+	})
+}
+
+func TestTLSSettings(t *testing.T) {
+	t.Run("Complete settings should be accepted", func(t *testing.T) {
+		assertNoError(t, checkTLSSettings("", "", "", false, nil))
+		assertNoError(t, checkTLSSettings("cert.pem", "key.pem", "", false, nil))
+		assertNoError(t, checkTLSSettings("cert.pem", "key.pem", "ca.pem", true, []string{clientRole}))
+	})
+
+	t.Run("Incomplete settings should be refused", func(t *testing.T) {
+		incompleteSettings := []struct {
+			certFile, keyFile, clientCAFile string
+			requireClientCert               bool
+			clientRoles                     []string
+		}{
+			{certFile: "cert.pem"},
+			{keyFile: "key.pem"},
+			{clientCAFile: "ca.pem"},
+			{certFile: "cert.pem", clientCAFile: "ca.pem"},
+			{certFile: "cert.pem", keyFile: "key.pem", requireClientCert: true},
+			{certFile: "cert.pem", keyFile: "key.pem", clientRoles: []string{clientRole}},
+			{requireClientCert: true},
+		}
+
+		for _, settings := range incompleteSettings {
+			if checkTLSSettings(settings.certFile, settings.keyFile, settings.clientCAFile, settings.requireClientCert, settings.clientRoles) == nil {
+				t.Errorf("settings %+v should be refused", settings)
+			}
+		}
+	})
+}
+
+// Helpers
+type testCertificateAuthority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCertificateAuthority(t *testing.T) testCertificateAuthority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assertNoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assertNoError(t, err)
+
+	certificate, err := x509.ParseCertificate(der)
+	assertNoError(t, err)
+
+	return testCertificateAuthority{certificate: certificate, key: key}
+}
+
+func (ca testCertificateAuthority) writeCertificate(t *testing.T, dir, name, commonName string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assertNoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if ip := net.ParseIP(commonName); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	assertNoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assertNoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	assertNoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assertNoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return
+}
+
+func assertCertificateName(t *testing.T, reloader *certificateReloader, want string) {
+	t.Helper()
+
+	certificate, _ := reloader.getCertificate(nil)
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	assertNoError(t, err)
+
+	assertResponseBody(t, leaf.Subject.CommonName, want)
+}
+
+func touchFiles(t *testing.T, modTime time.Time, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		assertNoError(t, os.Chtimes(path, modTime, modTime))
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	webhooks_url = "/api/admin/webhooks/"
+
+	createdNotification = "created"
+	deletedNotification = "deleted"
+
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+
+	signatureHeader        = "X-Webhook-Signature"
+	deliveryIdHeader       = "X-Webhook-Delivery"
+	notificationTypeHeader = "X-Webhook-Event"
+)
+
+var webhookClient = &http.Client{}
+
+var (
+	webhookDispatchInterval  = time.Second
+	webhookDispatchBatchSize = 100
+	webhookDeliveryTimeout   = 10 * time.Second
+	webhookConcurrency       = 8
+	webhookMaxAttempts       = 8
+	webhookRetryBaseDelay    = 30 * time.Second
+	webhookRetryMaxDelay     = 6 * time.Hour
+)
+
+// Webhook only receives the events of its tenant, the tenant of the principal that registered it
+type Webhook struct {
+	Id         int    `json:"id"`
+	Collection string `json:"collection"`
+	Tenant     string `json:"tenant,omitempty"`
+	Url        string `json:"url"`
+	Flags      []int  `json:"flags"`
+	Secret     string `json:"secret,omitempty"`
+}
+
+type Delivery struct {
+	Id             int       `json:"id"`
+	WebhookId      int       `json:"webhookid"`
+	Type           string    `json:"type"`
+	Payload        string    `json:"payload"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	NextAttempt    time.Time `json:"nextattempt"`
+	LastStatusCode int       `json:"laststatuscode"`
+	LastError      string    `json:"lasterror"`
+	CreatedAt      time.Time `json:"createdat"`
+}
+
+type notification struct {
+	Type          string  `json:"type"`
+	Collection    string  `json:"collection"`
+	Events        []Event `json:"events,omitempty"`
+	Id            *int    `json:"id,omitempty"`
+	Flag          *int    `json:"flag,omitempty"`
+	AffectedLines int     `json:"affectedlines"`
+}
+
+func getAllWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := getTenant(r)
+
+	webhookList := []Webhook{}
+	for _, webhook := range store.GetAllWebhooks() {
+		if webhook.Tenant == tenant {
+			webhook.Secret = ""
+			webhookList = append(webhookList, webhook)
+		}
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &webhookList)
+}
+
+func getWebhookByIdHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := extractIntFromURL(r, "id")
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	webhook, ok := getTenantWebhook(r, id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	webhook.Secret = ""
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &webhook)
+}
+
+func postWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, err := getWebhookFromRequest(r)
+
+	if err != nil || !isValidWebhook(webhook) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	webhook.Tenant = getTenant(r)
+	parameters := map[string]string{"collection": webhook.Collection, "url": webhook.Url}
+	if _, err := auditAction(r, parameters, func() int {
+		webhook.Id = store.RegisterWebhook(webhook)
+		parameters["id"] = strconv.Itoa(webhook.Id)
+		return 1
+	}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	webhook.Secret = ""
+
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &webhook)
+}
+
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := extractIntFromURL(r, "id")
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	affectedLines, err := auditAction(r, nil, func() (affectedLines int) {
+		if _, ok := getTenantWebhook(r, id); ok {
+			affectedLines = store.DeleteWebhook(id)
+		}
+
+		return
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = w.Write(formatLineNumberResponse(affectedLines))
+}
+
+func getDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := extractIntFromURL(r, "id")
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, ok := getTenantWebhook(r, id); !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	deliveryList := store.GetDeliveriesByWebhook(id)
+	if deliveryList == nil {
+		deliveryList = []Delivery{}
+	}
+
+	w.Header().Set("content-type", jsonContentType)
+	writeResponseBody(w, &deliveryList)
+}
+
+// getTenantWebhook hides the webhooks of other tenants as if they did not exist
+func getTenantWebhook(r *http.Request, id int) (Webhook, bool) {
+	webhook := store.GetWebhookById(id)
+	return webhook, webhook.Id != 0 && webhook.Tenant == getTenant(r)
+}
+
+func getWebhookFromRequest(r *http.Request) (webhook Webhook, err error) {
+	dataSent, _ := ioutil.ReadAll(r.Body)
+	if err = json.Unmarshal(dataSent, &webhook); err != nil {
+		return
+	}
+
+	if webhook.Collection == "" {
+		webhook.Collection = defaultController
+	}
+
+	return
+}
+
+func isValidWebhook(webhook Webhook) bool {
+	target, err := url.Parse(webhook.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return false
+	}
+
+	_, collectionExists := getEventStore(webhook.Collection)
+	return webhook.Secret != "" && collectionExists
+}
+
+// matches tells whether the webhook wants a notification for events of the tenant carrying one of these flags
+func (webhook Webhook) matches(collection, tenant string, flags []int) bool {
+	if webhook.Collection != collection || webhook.Tenant != tenant {
+		return false
+	}
+	if len(webhook.Flags) == 0 {
+		return true
+	}
+
+	for _, flag := range webhook.Flags {
+		if contains(flags, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func notifyCreatedEvents(collection string, eventList []Event) {
+	for _, webhook := range store.GetAllWebhooks() {
+		var matchingEvents []Event
+		for _, event := range eventList {
+			if webhook.matches(collection, event.Tenant, event.Flags) {
+				matchingEvents = append(matchingEvents, event)
+			}
+		}
+
+		if len(matchingEvents) > 0 {
+			enqueueDelivery(webhook, notification{Type: createdNotification, Collection: collection, Events: matchingEvents, AffectedLines: len(matchingEvents)})
+		}
+	}
+}
+
+func notifyDeletedEvent(collection string, event Event) {
+	id := event.Id
+
+	for _, webhook := range store.GetAllWebhooks() {
+		if webhook.matches(collection, event.Tenant, event.Flags) {
+			enqueueDelivery(webhook, notification{Type: deletedNotification, Collection: collection, Id: &id, AffectedLines: 1})
+		}
+	}
+}
+
+func notifyDeletedFlag(collection, tenant string, flag int, affectedLines int) {
+	for _, webhook := range store.GetAllWebhooks() {
+		if webhook.matches(collection, tenant, []int{flag}) {
+			enqueueDelivery(webhook, notification{Type: deletedNotification, Collection: collection, Flag: &flag, AffectedLines: affectedLines})
+		}
+	}
+}
+
+func enqueueDelivery(webhook Webhook, content notification) {
+	payload, _ := json.Marshal(&content)
+	now := clock.Now()
+
+	store.RegisterDelivery(Delivery{
+		WebhookId:   webhook.Id,
+		Type:        content.Type,
+		Payload:     string(payload),
+		Status:      deliveryPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+	})
+}
+
+func runWebhookDispatcher() {
+	for range time.Tick(webhookDispatchInterval) {
+		dispatchPendingDeliveries()
+	}
+}
+
+// dispatchPendingDeliveries sends the deliveries of up to webhookConcurrency webhooks at once, so
+// that a slow receiver does not hold back the others. The deliveries of a webhook are sent one
+// after the other to keep their order, and the store is updated once every attempt is over
+// dispatchPendingDeliveries sends at most webhookDispatchBatchSize deliveries per round, a webhook
+// stopping at its first failed attempt so that its deliveries keep their order
+func dispatchPendingDeliveries() {
+	var webhookIds []int
+	deliveriesByWebhook := map[int][]Delivery{}
+
+	for _, delivery := range store.GetPendingDeliveries(clock.Now(), webhookDispatchBatchSize) {
+		if _, ok := deliveriesByWebhook[delivery.WebhookId]; !ok {
+			webhookIds = append(webhookIds, delivery.WebhookId)
+		}
+		deliveriesByWebhook[delivery.WebhookId] = append(deliveriesByWebhook[delivery.WebhookId], delivery)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, webhookConcurrency)
+	attempted := make([][]Delivery, len(webhookIds))
+
+	for index, id := range webhookIds {
+		webhook, deliveryList := store.GetWebhookById(id), deliveriesByWebhook[id]
+
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			for i := range deliveryList {
+				if webhook.Id == 0 {
+					deliveryList[i].Status = deliveryFailed
+					deliveryList[i].LastError = "webhook deleted"
+					continue
+				}
+
+				attemptDelivery(webhook, &deliveryList[i])
+				if deliveryList[i].Status != deliveryDelivered {
+					deliveryList = deliveryList[:i+1]
+					break
+				}
+			}
+			attempted[index] = deliveryList
+		}(index)
+	}
+	wg.Wait()
+
+	for _, deliveryList := range attempted {
+		for _, delivery := range deliveryList {
+			store.UpdateDelivery(delivery)
+		}
+	}
+}
+
+func attemptDelivery(webhook Webhook, delivery *Delivery) {
+	delivery.Attempts++
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	statusCode, err := sendDelivery(webhook, *delivery)
+	delivery.LastStatusCode = statusCode
+
+	if err == nil && statusCode >= 200 && statusCode < 300 {
+		delivery.Status = deliveryDelivered
+		return
+	}
+
+	if err != nil {
+		delivery.LastError = err.Error()
+	} else {
+		delivery.LastError = fmt.Sprintf("unexpected status code %d", statusCode)
+	}
+
+	if delivery.Attempts >= webhookMaxAttempts {
+		delivery.Status = deliveryFailed
+	} else {
+		delivery.NextAttempt = clock.Now().Add(getRetryDelay(delivery.Attempts))
+	}
+}
+
+// sendDelivery bounds each request by webhookDeliveryTimeout, whatever the receiver does
+func sendDelivery(webhook Webhook, delivery Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookDeliveryTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("content-type", jsonContentType)
+	request.Header.Set(signatureHeader, signPayload(webhook.Secret, delivery.Payload))
+	request.Header.Set(deliveryIdHeader, strconv.Itoa(delivery.Id))
+	request.Header.Set(notificationTypeHeader, delivery.Type)
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode, nil
+}
+
+func signPayload(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// getRetryDelay doubles the delay after each failed attempt, up to webhookRetryMaxDelay
+func getRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBaseDelay
+	for i := 1; i < attempts && delay < webhookRetryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > webhookRetryMaxDelay {
+		return webhookRetryMaxDelay
+	}
+	return delay
+}
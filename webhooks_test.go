@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookAdministration(t *testing.T) {
+	t.Run("Post request should register the webhook without returning its secret", func(t *testing.T) {
+		stub := &StubEventStore{}
+		store = stub
+
+		request := newRequestWithBody(http.MethodPost, webhooks_url, Webhook{Url: "https://achievements.local/hook", Flags: []int{12}, Secret: "s3cr3t"})
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := Webhook{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertWebhook(t, got, Webhook{Id: 1, Collection: defaultController, Url: "https://achievements.local/hook", Flags: []int{12}})
+		assertResponseBody(t, stub.webhooks[0].Secret, "s3cr3t")
+	})
+
+	t.Run("Post request should return status code 422 when webhook is invalid", func(t *testing.T) {
+		store = &StubEventStore{}
+
+		invalidWebhooks := []Webhook{
+			{Url: "https://achievements.local/hook"},
+			{Url: "ftp://achievements.local/hook", Secret: "s3cr3t"},
+			{Url: "not an url", Secret: "s3cr3t"},
+			{Url: "https://achievements.local/hook", Secret: "s3cr3t", Collection: "unknown"},
+		}
+
+		for _, webhook := range invalidWebhooks {
+			request := newRequestWithBody(http.MethodPost, webhooks_url, webhook)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("Get request should return webhooks without their secret", func(t *testing.T) {
+		store = &StubEventStore{webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: "https://a.local", Secret: "s3cr3t"}}}
+
+		request := newGetRequest(webhooks_url)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := []Webhook{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if len(got) != 1 || got[0].Secret != "" {
+			t.Errorf("secret should not be returned, got %+v", got)
+		}
+
+		request = newGetRequest(webhooks_url + "2")
+		response = httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	t.Run("Created events should be delivered with an HMAC signature", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusOK)
+		defer receiver.Close()
+
+		stub := &StubEventStore{spy: &Spy{}, webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: receiver.URL, Flags: []int{5}, Secret: "s3cr3t"}}}
+		store = stub
+		clock = MockClock{}
+
+		postEventsTo(t, api_url, withoutIds(validEvent1, validEvent2))
+		dispatchPendingDeliveries()
+
+		requests := receiver.received()
+		if len(requests) != 1 {
+			t.Fatalf("expected one delivery, got %d", len(requests))
+		}
+
+		got := notification{}
+		_ = json.Unmarshal([]byte(requests[0].body), &got)
+
+		assertResponseBody(t, requests[0].signature, signPayload("s3cr3t", requests[0].body))
+		assertResponseBody(t, requests[0].eventType, createdNotification)
+		assertEventList(t, got.Events, stub.events[1:])
+		assertResponseBody(t, stub.deliveries[0].Status, deliveryDelivered)
+	})
+
+	t.Run("Deleted events should be delivered for matching flags", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusNoContent)
+		defer receiver.Close()
+
+		stub := &StubEventStore{
+			events:   []Event{validEvent1, validEvent2, validEvent4},
+			spy:      &Spy{},
+			webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: receiver.URL, Flags: []int{2}, Secret: "s3cr3t"}},
+		}
+		store = stub
+
+		for _, target := range []string{api_url + "1", api_url + "4", api_url + "deleteflag/2"} {
+			server.ServeHTTP(httptest.NewRecorder(), newDeleteRequest(target))
+		}
+		dispatchPendingDeliveries()
+
+		requests := receiver.received()
+		if len(requests) != 2 {
+			t.Fatalf("expected two deliveries, got %d", len(requests))
+		}
+
+		byId, byFlag := notification{}, notification{}
+		_ = json.Unmarshal([]byte(requests[0].body), &byId)
+		_ = json.Unmarshal([]byte(requests[1].body), &byFlag)
+
+		if byId.Type != deletedNotification || byId.Id == nil || *byId.Id != 1 {
+			t.Errorf("incorrect notification for deletion by id: %+v", byId)
+		}
+		if byFlag.Flag == nil || *byFlag.Flag != 2 || byFlag.AffectedLines != 1 {
+			t.Errorf("incorrect notification for deletion by flag: %+v", byFlag)
+		}
+	})
+
+	t.Run("Failed deliveries should be retried with exponential backoff", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusServiceUnavailable)
+		defer receiver.Close()
+
+		stubClock := &StubClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		clock = stubClock
+		defer func() { clock = MockClock{} }()
+
+		stub := &StubEventStore{spy: &Spy{}, webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: receiver.URL, Secret: "s3cr3t"}}}
+		store = stub
+
+		postEventsTo(t, api_url, []Event{validEvent1})
+
+		dispatchPendingDeliveries()
+		assertDelivery(t, stub.deliveries[0], deliveryPending, 1, stubClock.now.Add(webhookRetryBaseDelay))
+
+		dispatchPendingDeliveries()
+		assertDelivery(t, stub.deliveries[0], deliveryPending, 1, stubClock.now.Add(webhookRetryBaseDelay))
+
+		stubClock.now = stub.deliveries[0].NextAttempt
+		dispatchPendingDeliveries()
+		assertDelivery(t, stub.deliveries[0], deliveryPending, 2, stubClock.now.Add(2*webhookRetryBaseDelay))
+
+		for i := 2; i < webhookMaxAttempts; i++ {
+			stubClock.now = stub.deliveries[0].NextAttempt
+			dispatchPendingDeliveries()
+		}
+
+		assertResponseBody(t, stub.deliveries[0].Status, deliveryFailed)
+		if len(receiver.received()) != webhookMaxAttempts {
+			t.Errorf("expected %d attempts, got %d", webhookMaxAttempts, len(receiver.received()))
+		}
+	})
+
+	t.Run("Delivery log should list deliveries of the webhook", func(t *testing.T) {
+		store = &StubEventStore{webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: "https://a.local", Secret: "s3cr3t"}}, deliveries: []Delivery{{Id: 1, WebhookId: 1, Status: deliveryDelivered}, {Id: 2, WebhookId: 2}, {Id: 3, WebhookId: 1, Status: deliveryFailed}}}
+
+		request := newGetRequest(webhooks_url + "1/deliveries")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		got := []Delivery{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if len(got) != 2 || got[0].Id != 1 || got[1].Id != 3 {
+			t.Errorf("incorrect delivery log: %+v", got)
+		}
+	})
+
+	t.Run("Delivery log should return an empty list when the webhook has no delivery", func(t *testing.T) {
+		store = &StubEventStore{webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: "https://a.local", Secret: "s3cr3t"}}}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGetRequest(webhooks_url+"1/deliveries"))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "[]\n")
+	})
+
+	t.Run("Slow receivers should time out without holding back the other webhooks", func(t *testing.T) {
+		useWebhookDeliveryTimeout(t, 500*time.Millisecond)
+		clock = MockClock{}
+
+		release := make(chan struct{})
+		slowReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer slowReceiver.Close()
+		defer close(release)
+
+		fastReceiver := newWebhookReceiver(http.StatusOK)
+		defer fastReceiver.Close()
+
+		stub := &StubEventStore{spy: &Spy{}, webhooks: []Webhook{
+			{Id: 1, Collection: defaultController, Url: slowReceiver.URL, Secret: "s3cr3t"},
+			{Id: 2, Collection: defaultController, Url: fastReceiver.URL, Secret: "s3cr3t"},
+		}}
+		store = stub
+
+		postEventsTo(t, api_url, []Event{validEvent1})
+
+		fastDelivered := make(chan time.Duration, 1)
+		start := time.Now()
+		go func() {
+			for len(fastReceiver.received()) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			fastDelivered <- time.Since(start)
+		}()
+
+		dispatchPendingDeliveries()
+
+		if elapsed := <-fastDelivered; elapsed >= webhookDeliveryTimeout {
+			t.Errorf("fast webhook was delivered after %v, behind the slow one", elapsed)
+		}
+		if stub.deliveries[0].Status != deliveryPending || stub.deliveries[0].LastError == "" {
+			t.Errorf("slow delivery should be retried after its timeout, got %+v", stub.deliveries[0])
+		}
+		assertResponseBody(t, stub.deliveries[1].Status, deliveryDelivered)
+	})
+}
+
+func TestWebhookDispatchOrder(t *testing.T) {
+	t.Run("Deliveries of a webhook should stop at its first failure and keep their order", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusServiceUnavailable)
+		defer receiver.Close()
+
+		stubClock := &StubClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		clock = stubClock
+		defer func() { clock = MockClock{} }()
+
+		stub := &StubEventStore{spy: &Spy{}, webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: receiver.URL, Secret: "s3cr3t"}}}
+		store = stub
+
+		postEventsTo(t, api_url, []Event{validEvent1})
+		postEventsTo(t, api_url, []Event{validEvent2})
+
+		dispatchPendingDeliveries()
+		dispatchPendingDeliveries()
+
+		if len(receiver.received()) != 1 {
+			t.Errorf("expected a single attempt, got %d", len(receiver.received()))
+		}
+		assertDelivery(t, stub.deliveries[0], deliveryPending, 1, stubClock.now.Add(webhookRetryBaseDelay))
+		if stub.deliveries[1].Attempts != 0 {
+			t.Errorf("second delivery should wait for the first one, got %+v", stub.deliveries[1])
+		}
+	})
+
+	t.Run("A round should dispatch at most webhookDispatchBatchSize deliveries", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusOK)
+		defer receiver.Close()
+
+		previousBatchSize := webhookDispatchBatchSize
+		webhookDispatchBatchSize = 2
+		defer func() { webhookDispatchBatchSize = previousBatchSize }()
+
+		clock = MockClock{}
+		store = &StubEventStore{spy: &Spy{}, webhooks: []Webhook{{Id: 1, Collection: defaultController, Url: receiver.URL, Secret: "s3cr3t"}}}
+
+		for _, event := range []Event{validEvent1, validEvent2, validEvent3} {
+			postEventsTo(t, api_url, []Event{event})
+		}
+
+		dispatchPendingDeliveries()
+		if len(receiver.received()) != 2 {
+			t.Errorf("expected 2 deliveries in the first round, got %d", len(receiver.received()))
+		}
+
+		dispatchPendingDeliveries()
+		if len(receiver.received()) != 3 {
+			t.Errorf("expected 3 deliveries after the second round, got %d", len(receiver.received()))
+		}
+	})
+}
+
+func TestGetRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{1: webhookRetryBaseDelay, 2: 2 * webhookRetryBaseDelay, 4: 8 * webhookRetryBaseDelay, 100: webhookRetryMaxDelay}
+
+	for attempts, want := range cases {
+		if got := getRetryDelay(attempts); got != want {
+			t.Errorf("incorrect delay after %d attempts: got %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+// Test doubles
+type StubClock struct {
+	now time.Time
+}
+
+func (s *StubClock) Now() time.Time {
+	return s.now
+}
+
+type receivedWebhook struct {
+	body      string
+	signature string
+	eventType string
+}
+
+type webhookReceiver struct {
+	*httptest.Server
+	sync.Mutex
+	requests []receivedWebhook
+}
+
+func newWebhookReceiver(statusCode int) *webhookReceiver {
+	receiver := &webhookReceiver{}
+
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		receiver.Lock()
+		receiver.requests = append(receiver.requests, receivedWebhook{string(body), r.Header.Get(signatureHeader), r.Header.Get(notificationTypeHeader)})
+		receiver.Unlock()
+
+		w.WriteHeader(statusCode)
+	}))
+
+	return receiver
+}
+
+func (w *webhookReceiver) received() []receivedWebhook {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.requests
+}
+
+// Helpers
+func useWebhookDeliveryTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+
+	previousTimeout := webhookDeliveryTimeout
+	webhookDeliveryTimeout = timeout
+	t.Cleanup(func() { webhookDeliveryTimeout = previousTimeout })
+}
+
+func assertDelivery(t *testing.T, got Delivery, status string, attempts int, nextAttempt time.Time) {
+	t.Helper()
+
+	if got.Status != status || got.Attempts != attempts || !got.NextAttempt.Equal(nextAttempt) {
+		t.Errorf("incorrect delivery: got %s after %d attempts next at %v, want %s after %d attempts next at %v",
+			got.Status, got.Attempts, got.NextAttempt, status, attempts, nextAttempt)
+	}
+}
+
+func assertWebhook(t *testing.T, got, want Webhook) {
+	t.Helper()
+
+	gotAsJson, _ := json.Marshal(got)
+	wantAsJson, _ := json.Marshal(want)
+
+	if string(gotAsJson) != string(wantAsJson) {
+		t.Errorf("webhooks are different: got %s, want %s", gotAsJson, wantAsJson)
+	}
+}
+
+func postEventsTo(t *testing.T, target string, eventList []Event) {
+	t.Helper()
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, newPostRequestTo(target, eventList))
+
+	assertStatus(t, response.Code, http.StatusOK)
+	relayOutbox()
+}
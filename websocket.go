@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsPublish     = "publish"
+	wsAck         = "ack"
+	wsEvent       = "event"
+	wsError       = "error"
+)
+
+var upgrader = websocket.Upgrader{}
+
+type wsMessage struct {
+	Type          string       `json:"type"`
+	Id            string       `json:"id,omitempty"`
+	Flags         []int        `json:"flags,omitempty"`
+	Events        []Event      `json:"events,omitempty"`
+	Event         *Event       `json:"event,omitempty"`
+	AffectedLines *int         `json:"affectedlines,omitempty"`
+	Errors        []eventError `json:"errors,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	RetryAfter    int          `json:"retryafter,omitempty"`
+}
+
+// wsSession holds the state of one WebSocket connection: at most one subscription, and a lock
+// as the subscription pump and the request loop both write to the connection
+type wsSession struct {
+	conn         *websocket.Conn
+	eventStore   EventStore
+	collection   string
+	client       string
+	tenant       string
+	hiddenFlags  []int
+	canPublish   bool
+	writeLock    sync.Mutex
+	subscription *subscription
+}
+
+func websocketHandler(w http.ResponseWriter, r *http.Request, eventStore EventStore) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	if maxBodySize > 0 {
+		conn.SetReadLimit(maxBodySize)
+	}
+
+	session := &wsSession{
+		conn:        conn,
+		eventStore:  eventStore,
+		collection:  mux.Vars(r)["controller"],
+		tenant:      getTenant(r),
+		client:      getClientId(r),
+		hiddenFlags: getHiddenFlags(r),
+		canPublish:  isAllowed(r, writePermission),
+	}
+	defer session.close()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		message := wsMessage{}
+		if err := decodeJson(data, &message); err != nil {
+			session.send(wsMessage{Type: wsError, Error: "invalid message: " + err.Error()})
+			continue
+		}
+
+		session.handle(message)
+	}
+}
+
+func (s *wsSession) handle(message wsMessage) {
+	switch message.Type {
+	case wsSubscribe:
+		s.subscribe(message.Flags)
+		s.send(wsMessage{Type: wsAck, Id: message.Id})
+
+	case wsUnsubscribe:
+		s.unsubscribe()
+		s.send(wsMessage{Type: wsAck, Id: message.Id})
+
+	case wsPublish:
+		if !s.canPublish {
+			s.send(wsMessage{Type: wsError, Id: message.Id, Error: "publish is not allowed"})
+			return
+		}
+
+		// each publish counts as a request of the client, as its HTTP POST would
+		if requestRateLimit > 0 {
+			if ok, retryAfter := requestLimiter.allow(s.client, clock.Now(), requestRateLimit, requestBurstLimit); !ok {
+				s.send(wsMessage{Type: wsError, Id: message.Id, Error: errRateLimitExceeded.Error(), RetryAfter: getRetryAfterSeconds(retryAfter)})
+				return
+			}
+		}
+
+		if isBatchTooLong(message.Events) {
+			s.send(wsMessage{Type: wsError, Id: message.Id, Error: errBatchTooLong.Error()})
+			return
+		}
+
+		affectedLines, rejectedEvents, err := registerEvents(s.eventStore, s.collection, s.client, s.tenant, message.Events)
+		if quotaErr, ok := getQuotaExceededError(err); ok {
+			s.send(wsMessage{Type: wsError, Id: message.Id, Error: err.Error(), RetryAfter: getRetryAfterSeconds(quotaErr.retryAfter)})
+			return
+		}
+		if err != nil {
+			s.send(wsMessage{Type: wsError, Id: message.Id, Error: err.Error()})
+			return
+		}
+
+		s.send(wsMessage{Type: wsAck, Id: message.Id, AffectedLines: &affectedLines, Errors: rejectedEvents})
+
+	default:
+		s.send(wsMessage{Type: wsError, Id: message.Id, Error: "unknown message type " + message.Type})
+	}
+}
+
+// subscribe replaces the current subscription, if any
+func (s *wsSession) subscribe(flags []int) {
+	s.unsubscribe()
+
+	s.subscription = broker.subscribe(s.collection, s.tenant, flags, s.hiddenFlags)
+	go s.forward(s.subscription)
+}
+
+func (s *wsSession) unsubscribe() {
+	if s.subscription != nil {
+		broker.unsubscribe(s.subscription)
+		s.subscription = nil
+	}
+}
+
+func (s *wsSession) forward(subscription *subscription) {
+	for event := range subscription.events {
+		event := event
+		if s.send(wsMessage{Type: wsEvent, Event: &event}) != nil {
+			return
+		}
+	}
+}
+
+func (s *wsSession) send(message wsMessage) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	return s.conn.WriteJSON(message)
+}
+
+func (s *wsSession) close() {
+	s.unsubscribe()
+	_ = s.conn.Close()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebsocket(t *testing.T) {
+	t.Run("Publish should register valid events and acknowledge them", func(t *testing.T) {
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+		conn := dialWebsocket(t, api_url+"ws")
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsPublish, Id: "p1", Events: []Event{validEvent1, invalidEvent1, validEvent2}})
+
+		ack := readWebsocketMessage(t, conn)
+
+		assertResponseBody(t, ack.Type, wsAck)
+		assertResponseBody(t, ack.Id, "p1")
+		if ack.AffectedLines == nil || *ack.AffectedLines != 2 {
+			t.Errorf("incorrect affected lines: got %v, want 2", ack.AffectedLines)
+		}
+		assertEventList(t, spy.listGivenAsParameter, []Event{validEvent1, validEvent2})
+	})
+
+	t.Run("Subscribe should forward events with the requested flags", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		subscriber := dialWebsocket(t, api_url+"ws")
+		publisher := dialWebsocket(t, api_url+"ws")
+
+		sendWebsocketMessage(t, subscriber, wsMessage{Type: wsSubscribe, Id: "s1", Flags: []int{5}})
+		assertResponseBody(t, readWebsocketMessage(t, subscriber).Type, wsAck)
+
+		sendWebsocketMessage(t, publisher, wsMessage{Type: wsPublish, Events: withoutIds(validEvent1, validEvent2)})
+		readWebsocketMessage(t, publisher)
+		relayOutbox()
+
+		message := readWebsocketMessage(t, subscriber)
+
+		assertResponseBody(t, message.Type, wsEvent)
+		assertEvent(t, *message.Event, stub.events[1])
+	})
+
+	t.Run("Subscribe should also forward events posted over HTTP", func(t *testing.T) {
+		stub := &StubEventStore{spy: &Spy{}}
+		store = stub
+		testServer := httptest.NewServer(server)
+		defer testServer.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(testServer.URL, "http")+api_url+"ws", nil)
+		assertNoError(t, err)
+		defer conn.Close()
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsSubscribe})
+		readWebsocketMessage(t, conn)
+
+		postEvents(t, testServer.URL+api_url, withoutIds(validEvent4))
+
+		message := readWebsocketMessage(t, conn)
+
+		assertResponseBody(t, message.Type, wsEvent)
+		assertEvent(t, *message.Event, stub.events[0])
+	})
+
+	t.Run("Unsubscribe should stop forwarding events", func(t *testing.T) {
+		store = &StubEventStore{spy: &Spy{}}
+		conn := dialWebsocket(t, api_url+"ws")
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsSubscribe})
+		readWebsocketMessage(t, conn)
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsUnsubscribe, Id: "u1"})
+		assertResponseBody(t, readWebsocketMessage(t, conn).Id, "u1")
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: wsPublish, Id: "p2", Events: []Event{validEvent1}})
+
+		assertResponseBody(t, readWebsocketMessage(t, conn).Id, "p2")
+		assertNoWebsocketMessage(t, conn)
+	})
+
+	t.Run("Unknown or malformed messages should be answered with an error", func(t *testing.T) {
+		store = &StubEventStore{}
+		conn := dialWebsocket(t, api_url+"ws")
+
+		sendWebsocketMessage(t, conn, wsMessage{Type: "delete", Id: "d1"})
+		message := readWebsocketMessage(t, conn)
+		assertResponseBody(t, message.Type, wsError)
+		assertResponseBody(t, message.Id, "d1")
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte("{not json"))
+		assertResponseBody(t, readWebsocketMessage(t, conn).Type, wsError)
+	})
+
+	t.Run("Messages with unknown fields should be answered with an error in strict JSON mode", func(t *testing.T) {
+		useStrictJSON(t)
+		spy := &Spy{}
+		store = &StubEventStore{spy: spy}
+		conn := dialWebsocket(t, api_url+"ws")
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "publish", "id": "p3", "events": [{"flags": [5], "data": "{}", "color": "red"}]}`))
+		message := readWebsocketMessage(t, conn)
+
+		assertResponseBody(t, message.Type, wsError)
+		if !strings.Contains(message.Error, "unknown field") {
+			t.Errorf("incorrect error %q", message.Error)
+		}
+		if spy.calledFunction == registerFunctionName {
+			t.Error("events should not be registered")
+		}
+	})
+}
+
+// Helpers
+func dialWebsocket(t *testing.T, path string) *websocket.Conn {
+	t.Helper()
+
+	testServer := httptest.NewServer(server)
+	t.Cleanup(testServer.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(testServer.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatalf("unable to open websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func sendWebsocketMessage(t *testing.T, conn *websocket.Conn, message wsMessage) {
+	t.Helper()
+
+	if err := conn.WriteJSON(message); err != nil {
+		t.Fatalf("unable to send message: %v", err)
+	}
+}
+
+func readWebsocketMessage(t *testing.T, conn *websocket.Conn) (message wsMessage) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("unable to read message: %v", err)
+	}
+
+	return
+}
+
+func assertNoWebsocketMessage(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := conn.ReadMessage(); err == nil {
+		t.Errorf("unexpected message: %s", data)
+	}
+}